@@ -1,30 +1,106 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"homework/app/internal/broker"
 	"homework/app/internal/config"
 	"homework/app/internal/handlers"
+	"homework/app/internal/invites"
+	"homework/app/internal/jobs"
+	"homework/app/internal/mailer"
 	"homework/app/internal/middleware"
+	"homework/app/internal/payments"
+	"homework/app/internal/ratelimit"
+	"homework/app/internal/recurrence"
+	"homework/app/internal/reminders"
 	"homework/app/internal/storage"
+	"homework/app/internal/tickets"
+	"homework/app/internal/utils"
+	"homework/app/internal/webhooks"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	cfg := config.LoadConfig()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	utils.ConfigureTokens(cfg.Auth)
+	utils.ConfigureCookies(cfg.Cookie)
+	tickets.Configure(cfg.Tickets, cfg.Auth)
+	invites.Configure(cfg.Auth)
+	payments.Configure(cfg.Payments)
+	jobs.Configure(cfg.Jobs)
+
 	database := storage.Connect(&cfg)
 	defer database.Close()
 
+	cors, err := middleware.CORS(cfg.CORS)
+	if err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
+	}
+
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "postgres" {
+		limitStore = ratelimit.NewPostgresStore(database)
+	}
+	limit := func(name string) gin.HandlerFunc {
+		policy, ok := cfg.RateLimit.Policies[name]
+		if !cfg.RateLimit.Enabled || !ok {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middleware.RateLimit(limitStore, name, policy)
+	}
+
+	var hub broker.Broker = broker.NewLocal()
+	if cfg.Broker.Backend == "postgres" {
+		hub, err = broker.NewPostgres(database, cfg.Database.URL)
+		if err != nil {
+			log.Fatalf("Failed to listen for event updates: %v", err)
+		}
+	}
+
+	runner := jobs.NewRunner(database, cfg.Jobs)
+	dispatcher := webhooks.NewDispatcher(database, cfg.Webhooks)
+	dispatcher.RegisterJobs(runner)
+	mail := mailer.New(cfg.Mailer)
+	scheduler := reminders.NewScheduler(database, mail, cfg.Reminders)
+	scheduler.RegisterJobs(runner)
+	materializer := recurrence.NewMaterializer(database, cfg.Recurrence)
+	provider := payments.New(cfg.Payments, cfg.Auth)
+	handlers.RegisterPaymentJobs(runner, database, hub, provider)
+	handlers.RegisterInviteJobs(runner, database, mail)
+
 	r := gin.Default()
-	r.POST("/register", func(c *gin.Context) {
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	r.Use(cors, middleware.CSRF, middleware.APIKey(database))
+
+	r.GET("/healthz", handlers.HandleHealthz)
+
+	r.GET("/readyz", func(c *gin.Context) {
+		handlers.HandleReadyz(c, database, cfg.Database.ReadyTimeout)
+	})
+
+	r.POST("/register", limit("register"), func(c *gin.Context) {
 		handlers.HandleUserRegistration(c, database)
 	})
 
-	r.POST("/login", func(c *gin.Context) {
+	r.POST("/login", limit("login"), func(c *gin.Context) {
 		handlers.HandleUserLogin(c, database)
 	})
 
 	r.GET("/logout", func(c *gin.Context) {
-		c.SetCookie("token", "", -1, "/", "localhost", false, true)
+		utils.ClearAuthCookie(c)
 		c.JSON(200, gin.H{"message": "Logged out successfully"})
 	})
 
@@ -44,17 +120,333 @@ func main() {
 		handlers.CreateEvent(c, database)
 	})
 
+	r.POST("/events/import", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleImportEvents(c, database)
+	})
+
+	r.POST("/event-series", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateEventSeries(c, database, materializer)
+	})
+
+	r.GET("/event-series/:id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleGetEventSeries(c, database)
+	})
+
 	r.GET("/my-events", middleware.Auth, func(c *gin.Context) {
 		handlers.HandleMyEvents(c, database)
 	})
 
-	r.POST("/register-event", middleware.Auth, func(c *gin.Context) {
-		handlers.HandleRegistrationEvent(c, database)
+	r.POST("/register-event", middleware.Auth, limit("register_event"), func(c *gin.Context) {
+		handlers.HandleRegistrationEvent(c, database, hub, provider)
+	})
+
+	r.POST("/registrations/:id/checkout", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateCheckout(c, database, provider)
+	})
+
+	r.POST("/payments/webhook", func(c *gin.Context) {
+		handlers.HandlePaymentWebhook(c, database, hub, provider)
 	})
 
+	if fake, ok := provider.(*payments.Fake); ok && cfg.Payments.FakeCheckout {
+		log.Println("Fake checkout completion is enabled; do not use this in production")
+		r.POST("/payments/fake/checkouts/:checkout_id/complete", middleware.Auth, func(c *gin.Context) {
+			handlers.HandleFakeCheckoutComplete(c, database, hub, fake)
+		})
+	}
+
 	r.GET("/my-registrations", middleware.Auth, func(c *gin.Context) {
 		handlers.HandleListRegistrations(c, database)
 	})
 
-	r.Run()
+	r.POST("/cancel-registration", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCancelRegistration(c, database, hub)
+	})
+
+	r.GET("/events/:id/stream", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleEventStream(c, database, hub)
+	})
+
+	r.GET("/registrations/:id/ticket", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRegistrationTicket(c, database)
+	})
+
+	r.POST("/events/:id/check-in", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCheckIn(c, database)
+	})
+
+	r.GET("/events/:id/attendance", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleAttendanceReport(c, database)
+	})
+
+	r.GET("/events/:id/registrations/export", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleExportRegistrations(c, database)
+	})
+
+	r.GET("/events/:id", middleware.OptionalAuth, func(c *gin.Context) {
+		handlers.HandleGetEvent(c, database)
+	})
+
+	r.PUT("/events/:id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleUpdateEvent(c, database, hub, materializer)
+	})
+
+	r.POST("/events/:id/cancel", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCancelEvent(c, database, hub)
+	})
+
+	r.POST("/events/:id/publish", middleware.Auth, func(c *gin.Context) {
+		handlers.HandlePublishEvent(c, database, hub)
+	})
+
+	r.POST("/events/:id/complete", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCompleteEvent(c, database, hub)
+	})
+
+	r.POST("/events/:id/ticket-types", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateTicketType(c, database)
+	})
+
+	r.GET("/events/:id/ticket-types", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListTicketTypes(c, database)
+	})
+
+	r.PUT("/events/:id/ticket-types/:ticket_type_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleUpdateTicketType(c, database, hub)
+	})
+
+	r.DELETE("/events/:id/ticket-types/:ticket_type_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleDeleteTicketType(c, database)
+	})
+
+	r.POST("/events/:id/promo-codes", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreatePromoCode(c, database)
+	})
+
+	r.GET("/events/:id/promo-codes", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListPromoCodes(c, database)
+	})
+
+	r.DELETE("/events/:id/promo-codes/:promo_code_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleDeletePromoCode(c, database)
+	})
+
+	r.PUT("/events/:id/refund-policy", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleSetRefundPolicy(c, database)
+	})
+
+	r.GET("/events/:id/refund-policy", middleware.OptionalAuth, func(c *gin.Context) {
+		handlers.HandleGetRefundPolicy(c, database)
+	})
+
+	r.DELETE("/events/:id/refund-policy", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleDeleteRefundPolicy(c, database)
+	})
+
+	r.GET("/events/:id/ledger", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListLedger(c, database)
+	})
+
+	r.GET("/events/:id/applications", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListApplications(c, database)
+	})
+
+	r.POST("/events/:id/registrations/:registration_id/approve", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleApproveRegistration(c, database, hub)
+	})
+
+	r.POST("/events/:id/registrations/:registration_id/reject", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRejectRegistration(c, database, hub)
+	})
+
+	r.POST("/events/:id/questions", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateQuestion(c, database)
+	})
+
+	r.GET("/events/:id/questions", middleware.OptionalAuth, func(c *gin.Context) {
+		handlers.HandleListQuestions(c, database)
+	})
+
+	r.PUT("/events/:id/questions/:question_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleUpdateQuestion(c, database)
+	})
+
+	r.DELETE("/events/:id/questions/:question_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleDeleteQuestion(c, database)
+	})
+
+	r.POST("/events/:id/invite-links", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateInviteLink(c, database)
+	})
+
+	r.GET("/events/:id/invite-links", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListInviteLinks(c, database)
+	})
+
+	r.DELETE("/events/:id/invite-links/:link_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRevokeInviteLink(c, database)
+	})
+
+	r.POST("/events/:id/invites", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateInvites(c, database)
+	})
+
+	r.GET("/events/:id/invites", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListInvites(c, database)
+	})
+
+	r.DELETE("/events/:id/invites/:invite_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleDeleteInvite(c, database)
+	})
+
+	r.GET("/events/:id/organizers", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListOrganizers(c, database)
+	})
+
+	r.POST("/events/:id/organizers", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleAddOrganizer(c, database)
+	})
+
+	r.DELETE("/events/:id/organizers/:user_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRemoveOrganizer(c, database)
+	})
+
+	r.GET("/registrations/:id/guests", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListGuests(c, database)
+	})
+
+	r.POST("/registrations/:id/guests", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleAddGuest(c, database)
+	})
+
+	r.PUT("/registrations/:id/guests/:guest_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleUpdateGuest(c, database)
+	})
+
+	r.DELETE("/registrations/:id/guests/:guest_id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRemoveGuest(c, database)
+	})
+
+	r.GET("/registrations/:id/guests/:guest_id/ticket", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleGuestTicket(c, database)
+	})
+
+	r.POST("/registrations/:id/transfer", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateTransfer(c, database)
+	})
+
+	r.GET("/registrations/:id/transfers", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRegistrationTransfers(c, database)
+	})
+
+	r.GET("/transfers", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListTransfers(c, database)
+	})
+
+	r.POST("/transfers/:id/accept", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleAcceptTransfer(c, database)
+	})
+
+	r.POST("/transfers/:id/decline", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleDeclineTransfer(c, database)
+	})
+
+	r.POST("/transfers/:id/cancel", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCancelTransfer(c, database)
+	})
+
+	r.GET("/notification-preferences", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleGetNotificationPreferences(c, database)
+	})
+
+	r.PUT("/notification-preferences", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleUpdateNotificationPreferences(c, database)
+	})
+
+	r.GET("/notifications", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListNotifications(c, database)
+	})
+
+	r.POST("/notifications/:id/read", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleMarkNotificationRead(c, database)
+	})
+
+	r.POST("/notifications/read-all", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleMarkAllNotificationsRead(c, database)
+	})
+
+	r.POST("/api-keys", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateAPIKey(c, database)
+	})
+
+	r.GET("/api-keys", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListAPIKeys(c, database)
+	})
+
+	r.DELETE("/api-keys/:id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRevokeAPIKey(c, database)
+	})
+
+	r.POST("/webhooks", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleCreateWebhook(c, database)
+	})
+
+	r.GET("/webhooks", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListWebhooks(c, database)
+	})
+
+	r.DELETE("/webhooks/:id", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleDeleteWebhook(c, database)
+	})
+
+	r.GET("/webhooks/:id/deliveries", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleListWebhookDeliveries(c, database)
+	})
+
+	r.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", middleware.Auth, func(c *gin.Context) {
+		handlers.HandleRedeliverWebhook(c, database, dispatcher)
+	})
+
+	srv := &http.Server{Addr: ":" + cfg.Server.Port, Handler: r}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	runnerCtx, stopRunner := context.WithCancel(context.Background())
+	defer stopRunner()
+	runnerDone := make(chan struct{})
+	go func() {
+		runner.Run(runnerCtx)
+		close(runnerDone)
+	}()
+	if cfg.Reminders.Enabled {
+		go scheduler.Run(runnerCtx)
+	}
+	go materializer.Run(runnerCtx)
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down, failing readiness checks")
+	handlers.MarkShuttingDown()
+	time.Sleep(cfg.Server.DrainDelay)
+	// Live streams never finish on their own; end them so Shutdown can.
+	hub.Close()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+	}
+
+	stopRunner()
+	select {
+	case <-runnerDone:
+	case <-shutdownCtx.Done():
+		log.Println("Timed out waiting for background jobs to finish")
+	}
 }
@@ -0,0 +1,96 @@
+// Package broker fans out live event updates to subscribers such as SSE
+// streams. Local keeps everything in process; Postgres relays updates through
+// LISTEN/NOTIFY so subscribers on every replica see them.
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// Update is the live state of one event.
+type Update struct {
+	EventID          int    `json:"event_id"`
+	ParticipantCount int    `json:"participant_count"`
+	Capacity         *int   `json:"capacity"`
+	Status           string `json:"status"`
+}
+
+type Broker interface {
+	Publish(ctx context.Context, update Update) error
+	// Subscribe returns a channel of updates for eventID and a function that
+	// cancels the subscription. The channel is closed when the broker is.
+	Subscribe(eventID int) (<-chan Update, func())
+	Close()
+}
+
+type Local struct {
+	mu     sync.Mutex
+	subs   map[int]map[chan Update]struct{}
+	closed bool
+}
+
+func NewLocal() *Local {
+	return &Local{subs: make(map[int]map[chan Update]struct{})}
+}
+
+func (b *Local) Publish(_ context.Context, update Update) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Each update carries the full state of its event, so a subscriber only
+	// ever needs the latest one: an update it has not read yet is replaced.
+	// Publishers hold b.mu, so the slot stays free between the two selects.
+	for ch := range b.subs[update.EventID] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- update
+	}
+	return nil
+}
+
+func (b *Local) Subscribe(eventID int) (<-chan Update, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Update, 1)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs[eventID] == nil {
+		b.subs[eventID] = make(map[chan Update]struct{})
+	}
+	b.subs[eventID][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subs[eventID][ch]; ok {
+				delete(b.subs[eventID], ch)
+				if len(b.subs[eventID]) == 0 {
+					delete(b.subs, eventID)
+				}
+				close(ch)
+			}
+		})
+	}
+}
+
+// Close ends every subscription so long-lived streams return during shutdown.
+func (b *Local) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for eventID, chans := range b.subs {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(b.subs, eventID)
+	}
+}
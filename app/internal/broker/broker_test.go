@@ -0,0 +1,50 @@
+package broker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLocalKeepsLatestUpdateForSlowSubscribers(t *testing.T) {
+	b := NewLocal()
+	defer b.Close()
+	updates, cancel := b.Subscribe(1)
+	defer cancel()
+	other, cancelOther := b.Subscribe(2)
+	defer cancelOther()
+
+	for count := 1; count <= 3; count++ {
+		if err := b.Publish(context.Background(), Update{EventID: 1, ParticipantCount: count}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := <-updates; got.ParticipantCount != 3 {
+		t.Fatalf("participant_count = %d, want the latest 3", got.ParticipantCount)
+	}
+	select {
+	case got := <-updates:
+		t.Fatalf("stale update %+v left queued", got)
+	default:
+	}
+	select {
+	case got := <-other:
+		t.Fatalf("subscriber of another event got %+v", got)
+	default:
+	}
+}
+
+func TestLocalCloseEndsSubscriptions(t *testing.T) {
+	b := NewLocal()
+	updates, cancel := b.Subscribe(1)
+	b.Close()
+	if _, ok := <-updates; ok {
+		t.Fatal("channel still open after Close")
+	}
+	cancel()
+
+	late, _ := b.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Fatal("subscription after Close is open")
+	}
+}
@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const channel = "event_updates"
+
+// Postgres publishes with pg_notify and delivers what it hears on LISTEN to
+// local subscribers, so an update published on one replica reaches streams
+// on all of them.
+type Postgres struct {
+	*Local
+	db       *sqlx.DB
+	listener *pq.Listener
+}
+
+func NewPostgres(db *sqlx.DB, dsn string) (*Postgres, error) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event update listener: %v", err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	b := &Postgres{Local: NewLocal(), db: db, listener: listener}
+	go b.relay()
+	return b, nil
+}
+
+func (b *Postgres) Publish(ctx context.Context, update Update) error {
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, string(payload))
+	return err
+}
+
+func (b *Postgres) relay() {
+	for n := range b.listener.Notify {
+		// A nil notification signals a reconnect; updates sent meanwhile are
+		// lost, but the next one carries the full state again.
+		if n == nil {
+			continue
+		}
+		var update Update
+		if err := json.Unmarshal([]byte(n.Extra), &update); err != nil {
+			log.Printf("Event update listener: bad payload: %v", err)
+			continue
+		}
+		b.Local.Publish(context.Background(), update)
+	}
+}
+
+func (b *Postgres) Close() {
+	b.listener.Close()
+	b.Local.Close()
+}
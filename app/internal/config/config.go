@@ -1,23 +1,444 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Config is assembled from defaults, an optional config.yaml, APP_* environment
+// variables and command-line flags, in increasing order of precedence.
 type Config struct {
-	ServerPort  string
-	DatabaseURL string
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Auth       AuthConfig       `mapstructure:"auth"`
+	Cookie     CookieConfig     `mapstructure:"cookie"`
+	CORS       CORSConfig       `mapstructure:"cors"`
+	RateLimit  RateLimitConfig  `mapstructure:"rate_limit"`
+	Webhooks   WebhooksConfig   `mapstructure:"webhooks"`
+	Jobs       JobsConfig       `mapstructure:"jobs"`
+	Mailer     MailerConfig     `mapstructure:"mailer"`
+	Reminders  RemindersConfig  `mapstructure:"reminders"`
+	Broker     BrokerConfig     `mapstructure:"broker"`
+	Tickets    TicketsConfig    `mapstructure:"tickets"`
+	Recurrence RecurrenceConfig `mapstructure:"recurrence"`
+	Payments   PaymentsConfig   `mapstructure:"payments"`
+}
+
+type ServerConfig struct {
+	Port            string        `mapstructure:"port"`
+	DrainDelay      time.Duration `mapstructure:"drain_delay"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// TrustedProxies are the IPs and CIDRs of reverse proxies whose
+	// X-Forwarded-For header names the client. With none, the client is
+	// always the peer address.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+type DatabaseConfig struct {
+	URL             string        `mapstructure:"url"`
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ReadyTimeout    time.Duration `mapstructure:"ready_timeout"`
+}
+
+type AuthConfig struct {
+	// SigningKey signs new tokens. PreviousSigningKeys are still accepted
+	// when verifying so keys can be rotated without logging everyone out.
+	SigningKey          string        `mapstructure:"signing_key"`
+	PreviousSigningKeys []string      `mapstructure:"previous_signing_keys"`
+	TokenTTL            time.Duration `mapstructure:"token_ttl"`
+}
+
+type CookieConfig struct {
+	Name string `mapstructure:"name"`
+	// Domain is left empty for a host-only cookie, sent back only to the
+	// host that set it.
+	Domain   string `mapstructure:"domain"`
+	Path     string `mapstructure:"path"`
+	Secure   bool   `mapstructure:"secure"`
+	SameSite string `mapstructure:"same_site"`
+	// The CSRF cookie is readable by scripts; the client echoes its value
+	// back in CSRFHeaderName on state-changing requests.
+	CSRFCookieName string `mapstructure:"csrf_cookie_name"`
+	CSRFHeaderName string `mapstructure:"csrf_header_name"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string      `mapstructure:"allowed_origins"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Store is "memory" (per replica) or "postgres" (shared by all replicas).
+	Store    string                     `mapstructure:"store"`
+	Policies map[string]RateLimitPolicy `mapstructure:"policies"`
+}
+
+// RateLimitPolicy allows Requests per Per on average with bursts of up to
+// Burst requests, counted per Key: "ip", "user" or "api_key".
+type RateLimitPolicy struct {
+	Requests int           `mapstructure:"requests"`
+	Per      time.Duration `mapstructure:"per"`
+	Burst    int           `mapstructure:"burst"`
+	Key      string        `mapstructure:"key"`
+}
+
+type WebhooksConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+}
+
+// JobsConfig tunes the background job runner. MaxAttempts is the default
+// for jobs that do not set their own.
+type JobsConfig struct {
+	Workers        int           `mapstructure:"workers"`
+	PollInterval   time.Duration `mapstructure:"poll_interval"`
+	JobTimeout     time.Duration `mapstructure:"job_timeout"`
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+}
+
+// MailerConfig selects SMTP delivery; with an empty SMTPAddr mail is only
+// logged.
+type MailerConfig struct {
+	SMTPAddr string `mapstructure:"smtp_addr"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+}
+
+// RemindersConfig sends a reminder to each registrant at every offset before
+// an event starts, checking for due reminders once per Interval.
+type RemindersConfig struct {
+	Enabled  bool            `mapstructure:"enabled"`
+	Offsets  []time.Duration `mapstructure:"offsets"`
+	Interval time.Duration   `mapstructure:"interval"`
+}
+
+// BrokerConfig selects how live event updates reach streaming clients:
+// "memory" within one replica, or "postgres" via LISTEN/NOTIFY across all.
+type BrokerConfig struct {
+	Backend string `mapstructure:"backend"`
+}
+
+// TicketsConfig holds the key that signs ticket codes. When empty a key is
+// derived from auth.signing_key.
+type TicketsConfig struct {
+	SigningKey string `mapstructure:"signing_key"`
+}
+
+// RecurrenceConfig keeps the occurrences of recurring events materialized
+// Horizon ahead of now, extending every series once per Interval.
+type RecurrenceConfig struct {
+	Horizon  time.Duration `mapstructure:"horizon"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// PaymentsConfig selects the payment provider for paid tickets. A seat is
+// held for HoldTTL while its registration awaits payment. When WebhookSecret
+// is empty the fake provider derives one from auth.signing_key.
+// FakeCheckout exposes the endpoint that marks fake checkouts paid; it is
+// meant for development and tests only.
+type PaymentsConfig struct {
+	Provider        string        `mapstructure:"provider"`
+	WebhookSecret   string        `mapstructure:"webhook_secret"`
+	HoldTTL         time.Duration `mapstructure:"hold_ttl"`
+	CheckoutBaseURL string        `mapstructure:"checkout_base_url"`
+	FakeCheckout    bool          `mapstructure:"fake_checkout"`
+}
+
+const minSigningKeyLength = 32
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.port", "8080")
+	v.SetDefault("server.drain_delay", 5*time.Second)
+	v.SetDefault("server.shutdown_timeout", 15*time.Second)
+	v.SetDefault("server.trusted_proxies", []string{})
+
+	v.SetDefault("database.url", "")
+	v.SetDefault("database.max_open_conns", 25)
+	v.SetDefault("database.max_idle_conns", 5)
+	v.SetDefault("database.conn_max_lifetime", 30*time.Minute)
+	v.SetDefault("database.ready_timeout", 2*time.Second)
+
+	v.SetDefault("auth.signing_key", "")
+	v.SetDefault("auth.previous_signing_keys", []string{})
+	v.SetDefault("auth.token_ttl", time.Hour)
+
+	v.SetDefault("cookie.name", "token")
+	v.SetDefault("cookie.domain", "")
+	v.SetDefault("cookie.path", "/")
+	v.SetDefault("cookie.secure", false)
+	v.SetDefault("cookie.same_site", "lax")
+	v.SetDefault("cookie.csrf_cookie_name", "csrf_token")
+	v.SetDefault("cookie.csrf_header_name", "X-CSRF-Token")
+
+	v.SetDefault("cors.allowed_origins", []string{})
+	v.SetDefault("cors.allowed_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+	v.SetDefault("cors.allowed_headers", []string{"Content-Type", "Authorization", "X-CSRF-Token"})
+	v.SetDefault("cors.exposed_headers", []string{})
+	v.SetDefault("cors.allow_credentials", false)
+	v.SetDefault("cors.max_age", 10*time.Minute)
+
+	v.SetDefault("rate_limit.enabled", true)
+	v.SetDefault("rate_limit.store", "memory")
+	v.SetDefault("rate_limit.policies", map[string]any{
+		"register":       map[string]any{"requests": 5, "per": "1m", "burst": 5, "key": "ip"},
+		"login":          map[string]any{"requests": 10, "per": "1m", "burst": 10, "key": "ip"},
+		"register_event": map[string]any{"requests": 30, "per": "1m", "burst": 10, "key": "user"},
+	})
+
+	v.SetDefault("webhooks.max_attempts", 8)
+	v.SetDefault("webhooks.timeout", 10*time.Second)
+
+	v.SetDefault("jobs.workers", 4)
+	v.SetDefault("jobs.poll_interval", time.Second)
+	v.SetDefault("jobs.job_timeout", time.Minute)
+	v.SetDefault("jobs.max_attempts", 10)
+	v.SetDefault("jobs.initial_backoff", 30*time.Second)
+	v.SetDefault("jobs.max_backoff", 6*time.Hour)
+
+	v.SetDefault("mailer.smtp_addr", "")
+	v.SetDefault("mailer.username", "")
+	v.SetDefault("mailer.password", "")
+	v.SetDefault("mailer.from", "noreply@localhost")
+
+	v.SetDefault("reminders.enabled", true)
+	v.SetDefault("reminders.offsets", []string{"24h", "1h"})
+	v.SetDefault("reminders.interval", time.Minute)
+
+	v.SetDefault("broker.backend", "memory")
+
+	v.SetDefault("tickets.signing_key", "")
+
+	v.SetDefault("recurrence.horizon", 90*24*time.Hour)
+	v.SetDefault("recurrence.interval", time.Hour)
+
+	v.SetDefault("payments.provider", "fake")
+	v.SetDefault("payments.webhook_secret", "")
+	v.SetDefault("payments.hold_ttl", 15*time.Minute)
+	v.SetDefault("payments.checkout_base_url", "http://localhost:8080")
+	v.SetDefault("payments.fake_checkout", false)
+}
+
+// Load reads the configuration and validates it. args are the command-line
+// arguments without the program name.
+func Load(args []string) (Config, error) {
+	v := viper.New()
+	setDefaults(v)
+
+	flags := pflag.NewFlagSet("homework", pflag.ContinueOnError)
+	configFile := flags.String("config", "", "path to a config file (default ./config.yaml if present)")
+	flags.String("port", "", "HTTP port to listen on")
+	flags.String("database-url", "", "Postgres connection URL")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	bindings := map[string]string{
+		"server.port":  "port",
+		"database.url": "database-url",
+	}
+	for key, flag := range bindings {
+		if err := v.BindPFlag(key, flags.Lookup(flag)); err != nil {
+			return Config{}, err
+		}
+	}
+
+	v.SetEnvPrefix("APP")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	// SIGNING_KEY predates the APP_ prefix and is still honoured.
+	if err := v.BindEnv("auth.signing_key", "APP_AUTH_SIGNING_KEY", "SIGNING_KEY"); err != nil {
+		return Config{}, err
+	}
+
+	if *configFile != "" {
+		v.SetConfigFile(*configFile)
+	} else {
+		v.SetConfigName("config")
+		v.SetConfigType("yaml")
+		v.AddConfigPath(".")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if *configFile != "" || !errors.As(err, &notFound) {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return Config{}, fmt.Errorf("decoding config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
 }
 
-func LoadConfig() Config {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
+// Validate reports every problem at once so a misconfigured deployment can be
+// fixed in one go.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.Server.Port == "" {
+		problems = append(problems, "server.port (APP_SERVER_PORT) must be set")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+	if c.Server.DrainDelay < 0 {
+		problems = append(problems, "server.drain_delay must not be negative")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("server.trusted_proxies: %q is not an IP or CIDR", proxy))
+		}
+	}
+
+	if c.Database.URL == "" {
+		problems = append(problems, "database.url (APP_DATABASE_URL) must be set")
+	}
+	if c.Database.MaxOpenConns < 1 {
+		problems = append(problems, "database.max_open_conns must be at least 1")
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database.max_idle_conns must be between 0 and database.max_open_conns")
+	}
+	if c.Database.ReadyTimeout <= 0 {
+		problems = append(problems, "database.ready_timeout must be positive")
+	}
+
+	if len(c.Auth.SigningKey) < minSigningKeyLength {
+		problems = append(problems, fmt.Sprintf("auth.signing_key (APP_AUTH_SIGNING_KEY) must be at least %d characters", minSigningKeyLength))
+	}
+	if c.Tickets.SigningKey != "" && len(c.Tickets.SigningKey) < minSigningKeyLength {
+		problems = append(problems, fmt.Sprintf("tickets.signing_key (APP_TICKETS_SIGNING_KEY) must be empty or at least %d characters", minSigningKeyLength))
+	}
+	if c.Auth.TokenTTL <= 0 {
+		problems = append(problems, "auth.token_ttl must be positive")
+	}
+
+	if c.Cookie.Name == "" || c.Cookie.CSRFCookieName == "" || c.Cookie.CSRFHeaderName == "" {
+		problems = append(problems, "cookie.name, cookie.csrf_cookie_name and cookie.csrf_header_name must be set")
+	}
+	switch strings.ToLower(c.Cookie.SameSite) {
+	case "lax", "strict":
+	case "none":
+		if !c.Cookie.Secure {
+			problems = append(problems, "cookie.same_site=none requires cookie.secure=true")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("cookie.same_site: %q must be one of lax, strict, none", c.Cookie.SameSite))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				problems = append(problems, "cors.allowed_origins cannot contain \"*\" when cors.allow_credentials is true")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			problems = append(problems, fmt.Sprintf("cors.allowed_origins: %q is not an origin like https://example.com", origin))
+		}
+	}
 
-	err := viper.ReadInConfig()
-	if err != nil {
-		panic(err)
+	if c.CORS.MaxAge < 0 {
+		problems = append(problems, "cors.max_age must not be negative")
 	}
-	return Config{
-		ServerPort:  viper.GetString("server.port"),
-		DatabaseURL: viper.GetString("database.url"),
+
+	switch c.RateLimit.Store {
+	case "memory", "postgres":
+	default:
+		problems = append(problems, fmt.Sprintf("rate_limit.store: %q must be memory or postgres", c.RateLimit.Store))
+	}
+	for name, policy := range c.RateLimit.Policies {
+		if policy.Requests < 1 || policy.Per <= 0 || policy.Burst < 1 {
+			problems = append(problems, fmt.Sprintf("rate_limit.policies.%s: requests, per and burst must be positive", name))
+		}
+		switch policy.Key {
+		case "ip", "user", "api_key":
+		default:
+			problems = append(problems, fmt.Sprintf("rate_limit.policies.%s.key: %q must be ip, user or api_key", name, policy.Key))
+		}
+	}
+
+	if c.Webhooks.MaxAttempts < 1 {
+		problems = append(problems, "webhooks.max_attempts must be at least 1")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		problems = append(problems, "webhooks.timeout must be positive")
+	}
+
+	if c.Jobs.Workers < 1 || c.Jobs.MaxAttempts < 1 {
+		problems = append(problems, "jobs.workers and jobs.max_attempts must be at least 1")
+	}
+	if c.Jobs.PollInterval <= 0 || c.Jobs.JobTimeout <= 0 {
+		problems = append(problems, "jobs.poll_interval and jobs.job_timeout must be positive")
+	}
+	if c.Jobs.InitialBackoff <= 0 || c.Jobs.MaxBackoff < c.Jobs.InitialBackoff {
+		problems = append(problems, "jobs.initial_backoff must be positive and not exceed jobs.max_backoff")
+	}
+
+	if c.Mailer.SMTPAddr != "" && c.Mailer.From == "" {
+		problems = append(problems, "mailer.from must be set when mailer.smtp_addr is")
+	}
+
+	if c.Reminders.Interval <= 0 {
+		problems = append(problems, "reminders.interval must be positive")
+	}
+	for _, offset := range c.Reminders.Offsets {
+		if offset <= 0 {
+			problems = append(problems, fmt.Sprintf("reminders.offsets: %s must be positive", offset))
+		}
+	}
+
+	switch c.Broker.Backend {
+	case "memory", "postgres":
+	default:
+		problems = append(problems, fmt.Sprintf("broker.backend: %q must be memory or postgres", c.Broker.Backend))
+	}
+
+	if c.Recurrence.Horizon < 24*time.Hour {
+		problems = append(problems, "recurrence.horizon must be at least 24h")
+	}
+	if c.Recurrence.Interval <= 0 {
+		problems = append(problems, "recurrence.interval must be positive")
+	}
+
+	switch c.Payments.Provider {
+	case "fake":
+	default:
+		problems = append(problems, fmt.Sprintf("payments.provider: %q must be fake", c.Payments.Provider))
+	}
+	if c.Payments.HoldTTL <= 0 {
+		problems = append(problems, "payments.hold_ttl must be positive")
+	}
+	if u, err := url.Parse(c.Payments.CheckoutBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("payments.checkout_base_url: %q must be an absolute URL", c.Payments.CheckoutBaseURL))
+	}
+	if c.Payments.FakeCheckout && c.Payments.Provider != "fake" {
+		problems = append(problems, "payments.fake_checkout requires the fake provider")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
 	}
+	return nil
 }
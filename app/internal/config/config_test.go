@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// validConfig is the default configuration with the settings that have no
+// default filled in.
+func validConfig(t *testing.T) Config {
+	t.Helper()
+	v := viper.New()
+	setDefaults(v)
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.URL = "postgres://localhost/homework"
+	cfg.Auth.SigningKey = strings.Repeat("k", minSigningKeyLength)
+	return cfg
+}
+
+func TestValidateAcceptsDefaults(t *testing.T) {
+	if err := validConfig(t).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"no database url", func(c *Config) { c.Database.URL = "" }, "database.url (APP_DATABASE_URL) must be set"},
+		{"short signing key", func(c *Config) { c.Auth.SigningKey = "short" }, "auth.signing_key (APP_AUTH_SIGNING_KEY) must be at least 32 characters"},
+		{"short ticket key", func(c *Config) { c.Tickets.SigningKey = "short" }, "tickets.signing_key"},
+		{"bad trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"} }, `"proxy.local" is not an IP or CIDR`},
+		{"idle above open conns", func(c *Config) { c.Database.MaxIdleConns = c.Database.MaxOpenConns + 1 }, "database.max_idle_conns"},
+		{"unknown same site", func(c *Config) { c.Cookie.SameSite = "loose" }, `cookie.same_site: "loose"`},
+		{"insecure same site none", func(c *Config) { c.Cookie.SameSite = "None" }, "cookie.same_site=none requires cookie.secure=true"},
+		{"no csrf header", func(c *Config) { c.Cookie.CSRFHeaderName = "" }, "cookie.csrf_header_name must be set"},
+		{"wildcard origin with credentials", func(c *Config) {
+			c.CORS.AllowedOrigins = []string{"*"}
+			c.CORS.AllowCredentials = true
+		}, `cannot contain "*"`},
+		{"origin with a path", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://example.com/app"} }, `"https://example.com/app" is not an origin`},
+		{"origin without a scheme", func(c *Config) { c.CORS.AllowedOrigins = []string{"example.com"} }, `"example.com" is not an origin`},
+		{"unknown rate limit store", func(c *Config) { c.RateLimit.Store = "redis" }, `rate_limit.store: "redis"`},
+		{"unknown rate limit key", func(c *Config) {
+			c.RateLimit.Policies["login"] = RateLimitPolicy{Requests: 1, Per: time.Minute, Burst: 1, Key: "email"}
+		}, `rate_limit.policies.login.key: "email"`},
+		{"empty rate limit policy", func(c *Config) { c.RateLimit.Policies["login"] = RateLimitPolicy{Key: "ip"} }, "rate_limit.policies.login: requests, per and burst must be positive"},
+		{"backoff above maximum", func(c *Config) { c.Jobs.InitialBackoff = c.Jobs.MaxBackoff + time.Second }, "jobs.initial_backoff"},
+		{"smtp without sender", func(c *Config) {
+			c.Mailer.SMTPAddr = "smtp.example.com:587"
+			c.Mailer.From = ""
+		}, "mailer.from must be set"},
+		{"negative reminder offset", func(c *Config) { c.Reminders.Offsets = []time.Duration{-time.Hour} }, "reminders.offsets: -1h0m0s must be positive"},
+		{"unknown broker", func(c *Config) { c.Broker.Backend = "redis" }, `broker.backend: "redis"`},
+		{"short recurrence horizon", func(c *Config) { c.Recurrence.Horizon = time.Hour }, "recurrence.horizon must be at least 24h"},
+	}
+	for _, tt := range tests {
+		cfg := validConfig(t)
+		tt.change(&cfg)
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Validate() = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Database.URL = ""
+	cfg.Broker.Backend = "redis"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "database.url") || !strings.Contains(err.Error(), "broker.backend") {
+		t.Fatalf("Validate() = %v, want both problems", err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	t.Setenv("APP_DATABASE_URL", "postgres://env/homework")
+	t.Setenv("SIGNING_KEY", strings.Repeat("s", minSigningKeyLength))
+	t.Setenv("APP_SERVER_PORT", "9000")
+
+	cfg, err := Load([]string{"--config", "../../../config.example.yaml", "--port", "9100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "9100" {
+		t.Errorf("port = %q, want the flag to win", cfg.Server.Port)
+	}
+	if cfg.Database.URL != "postgres://env/homework" {
+		t.Errorf("database.url = %q, want the environment to beat the file", cfg.Database.URL)
+	}
+	if cfg.Auth.SigningKey != strings.Repeat("s", minSigningKeyLength) {
+		t.Errorf("auth.signing_key = %q, want SIGNING_KEY honoured", cfg.Auth.SigningKey)
+	}
+}
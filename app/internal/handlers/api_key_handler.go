@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"database/sql"
+	"homework/app/internal/models"
+	"homework/app/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, created_at, revoked_at"
+
+func HandleCreateAPIKey(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	var payload models.CreateAPIKeyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	key, err := utils.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	var apiKey models.APIKey
+	query := "INSERT INTO api_keys (user_id, name, prefix, key_hash) VALUES ($1, $2, $3, $4) RETURNING " + apiKeyColumns
+	if err := db.Get(&apiKey, query, userID, payload.Name, key[:utils.APIKeyPrefixLen], utils.HashAPIKey(key)); err != nil {
+		log.Printf("Error creating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	// The key is only ever shown once, at creation.
+	c.JSON(http.StatusCreated, gin.H{"api_key": apiKey, "key": key})
+}
+
+func HandleListAPIKeys(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	keys := []models.APIKey{}
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = $1 ORDER BY id"
+	if err := db.Select(&keys, query, userID); err != nil {
+		log.Printf("Error fetching API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// HandleRevokeAPIKey stops a key from authenticating. Revoked keys stay
+// listed with the time they were revoked.
+func HandleRevokeAPIKey(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	keyID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var apiKey models.APIKey
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now())
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + apiKeyColumns
+	if err := db.Get(&apiKey, query, keyID, userID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error revoking API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked", "api_key": apiKey})
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"homework/app/internal/payments"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// HandleListApplications returns the registrations of an event still
+// waiting for the organizer's approval, oldest first.
+func HandleListApplications(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	applications := []struct {
+		ID               int       `db:"id" json:"registration_id"`
+		ParticipantID    int       `db:"participant_id" json:"participant_id"`
+		Username         string    `db:"username" json:"username"`
+		Email            string    `db:"email" json:"email"`
+		RegistrationDate time.Time `db:"registration_date" json:"registration_date"`
+		TicketTypeID     *int      `db:"ticket_type_id" json:"ticket_type_id"`
+		Quantity         int       `db:"quantity" json:"quantity"`
+		Amount           int64     `db:"amount" json:"amount"`
+		Currency         string    `db:"currency" json:"currency"`
+	}{}
+	query := `SELECT r.id, r.participant_id, u.username, u.email, r.registration_date, r.ticket_type_id, r.quantity, r.amount, r.currency
+		FROM registrations r JOIN users u ON u.id = r.participant_id
+		WHERE r.event_id = $1 AND r.status = 'pending'
+		ORDER BY r.id`
+	if err := db.Select(&applications, query, eventID); err != nil {
+		log.Printf("Error fetching applications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch applications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, applications)
+}
+
+// HandleApproveRegistration accepts a pending registration. It then takes
+// seats like a new registration would: confirmed if free, held for payment
+// if paid, or waitlisted if the event or its ticket type is full.
+func HandleApproveRegistration(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	reviewRegistration(c, db, hub, true)
+}
+
+// HandleRejectRegistration turns down a pending registration with a reason.
+func HandleRejectRegistration(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	reviewRegistration(c, db, hub, false)
+}
+
+func reviewRegistration(c *gin.Context, db *sqlx.DB, hub broker.Broker, approve bool) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "registration_id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	// Approving needs no body.
+	var payload models.ReviewRegistrationPayload
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if !approve && payload.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to reject"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var event models.Event
+	query := "SELECT id, name, created_by, participant_count, capacity, status FROM events WHERE id = $1 FOR UPDATE"
+	if err := tx.Get(&event, query, eventID); err != nil {
+		log.Printf("Error fetching event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review registration"})
+		return
+	}
+	if approve && !registrationOpen(c, event) {
+		return
+	}
+
+	var registration models.Registration
+	query = "SELECT " + registrationPaymentColumns + " FROM registrations WHERE id = $1 AND event_id = $2 FOR UPDATE"
+	if err := tx.Get(&registration, query, registrationID, eventID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review registration"})
+		return
+	}
+	if registration.Status != models.RegistrationPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration is not awaiting approval", "status": registration.Status})
+		return
+	}
+
+	status := models.RegistrationRejected
+	if approve {
+		if status, err = approvedStatus(c.Request.Context(), tx, event, registration); err != nil {
+			log.Printf("Error checking availability: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review registration"})
+			return
+		}
+	}
+	var holdExpiresAt *time.Time
+	if status == models.RegistrationPendingPayment {
+		deadline := payments.HoldDeadline()
+		holdExpiresAt = &deadline
+	}
+
+	query = `UPDATE registrations SET status = $1, hold_expires_at = $2, reviewed_at = now(), reviewed_by = $3, review_reason = NULLIF($4, '')
+		WHERE id = $5
+		RETURNING ` + registrationPaymentColumns
+	if err := tx.Get(&registration, query, status, holdExpiresAt, userID, payload.Reason, registration.ID); err != nil {
+		log.Printf("Error reviewing registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review registration"})
+		return
+	}
+
+	if err := applyReview(c.Request.Context(), tx, event, registration); err != nil {
+		log.Printf("Error applying review: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review registration"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	publishEventState(c.Request.Context(), db, hub, eventID)
+
+	message := "Registration rejected"
+	if approve {
+		message = "Registration approved"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "registration": registration})
+}
+
+// approvedStatus decides where an approved registration goes, given what is
+// left of the event's capacity and of its ticket type.
+func approvedStatus(ctx context.Context, tx *sqlx.Tx, event models.Event, registration models.Registration) (string, error) {
+	var ticketType *models.TicketType
+	if registration.TicketTypeID != nil {
+		ticketType = &models.TicketType{}
+		query := "SELECT " + ticketTypeColumns + " FROM ticket_types WHERE id = $1"
+		if err := tx.GetContext(ctx, ticketType, query, *registration.TicketTypeID); err != nil {
+			return "", err
+		}
+	}
+	return seatStatus(event, ticketType, registration.Quantity, registration.Amount), nil
+}
+
+// applyReview takes the seats of a reviewed registration where it got any
+// and tells the applicant about the decision.
+func applyReview(ctx context.Context, tx *sqlx.Tx, event models.Event, registration models.Registration) error {
+	if registration.Status == models.RegistrationRejected {
+		return notifications.Notify(ctx, tx, registration.ParticipantID, notifications.KindApplicationRejected,
+			"Your application for "+event.Name+" was declined", *registration.ReviewReason, event.ID)
+	}
+
+	var body string
+	switch registration.Status {
+	case models.RegistrationWaitlisted:
+		body = "The event is full, so you are on the waitlist."
+	case models.RegistrationPendingPayment:
+		if err := confirmSeats(ctx, tx, registration); err != nil {
+			return err
+		}
+		if err := scheduleHoldExpiry(ctx, tx, registration); err != nil {
+			return err
+		}
+		body = "A seat is held for you. Complete the checkout before " + registration.HoldExpiresAt.UTC().Format(time.RFC1123) + " to confirm it."
+	default:
+		if err := confirmSeats(ctx, tx, registration); err != nil {
+			return err
+		}
+		if err := announceRegistration(ctx, tx, event, registration); err != nil {
+			return err
+		}
+		body = "Your registration is confirmed."
+	}
+	if registration.ReviewReason != nil {
+		body += "\n\n" + *registration.ReviewReason
+	}
+	return notifications.Notify(ctx, tx, registration.ParticipantID, notifications.KindApplicationApproved,
+		"Your application for "+event.Name+" was approved", body, event.ID)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"database/sql"
+	"homework/app/internal/models"
+	"homework/app/internal/tickets"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func HandleRegistrationTicket(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var registration models.Registration
+	query := "SELECT id, event_id, participant_id, status, ticket_nonce FROM registrations WHERE id = $1"
+	err := db.Get(&registration, query, registrationID)
+	if err == sql.ErrNoRows || (err == nil && registration.ParticipantID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch registration"})
+		return
+	}
+	if registration.Status != models.RegistrationConfirmed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only confirmed registrations have a ticket", "status": registration.Status})
+		return
+	}
+
+	ticket := tickets.Ticket{RegistrationID: registration.ID, EventID: registration.EventID, Nonce: registration.TicketNonce}
+	writeTicket(c, ticket, gin.H{"registration_id": registration.ID, "event_id": registration.EventID})
+}
+
+// writeTicket responds with the ticket's code, added to body, or with its
+// QR code when the PNG format is asked for.
+func writeTicket(c *gin.Context, ticket tickets.Ticket, body gin.H) {
+	if c.Query("format") == "png" {
+		png, err := tickets.QRCode(ticket)
+		if err != nil {
+			log.Printf("Error rendering ticket QR code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render ticket"})
+			return
+		}
+		c.Header("Cache-Control", "private, no-store")
+		c.Data(http.StatusOK, "image/png", png)
+		return
+	}
+
+	body["code"] = tickets.Code(ticket)
+	c.JSON(http.StatusOK, body)
+}
+
+func HandleCheckIn(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerCheckIn); !ok {
+		return
+	}
+
+	var payload models.CheckInPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	ticket, err := tickets.Parse(payload.Code)
+	if err != nil || ticket.EventID != eventID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if ticket.GuestID != 0 {
+		checkInGuest(c, tx, userID, ticket)
+		return
+	}
+
+	var registration models.Registration
+	query := `SELECT id, event_id, participant_id, registration_date, status, ticket_nonce, checked_in_at, checked_in_by
+		FROM registrations WHERE id = $1 AND event_id = $2 FOR UPDATE`
+	err = tx.Get(&registration, query, ticket.RegistrationID, eventID)
+	if err == sql.ErrNoRows || (err == nil && registration.TicketNonce != ticket.Nonce) {
+		// A nonce mismatch means the ticket was reissued and this code revoked.
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+	if registration.Status != models.RegistrationConfirmed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration is not confirmed", "status": registration.Status})
+		return
+	}
+	if registration.CheckedInAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ticket already checked in", "checked_in_at": registration.CheckedInAt})
+		return
+	}
+
+	query = "UPDATE registrations SET checked_in_at = now(), checked_in_by = $1 WHERE id = $2 RETURNING checked_in_at, checked_in_by"
+	if err := tx.QueryRowx(query, userID, registration.ID).Scan(&registration.CheckedInAt, &registration.CheckedInBy); err != nil {
+		log.Printf("Error checking in registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Checked in", "registration": registration})
+}
+
+func HandleAttendanceReport(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	event, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerCheckIn)
+	if !ok {
+		return
+	}
+
+	var report struct {
+		Registered     int `db:"registered" json:"registered"`
+		Attended       int `db:"attended" json:"attended"`
+		Waitlisted     int `db:"waitlisted" json:"waitlisted"`
+		Cancelled      int `db:"cancelled" json:"cancelled"`
+		Pending        int `db:"pending" json:"pending"`
+		Rejected       int `db:"rejected" json:"rejected"`
+		Guests         int `db:"guests" json:"guests"`
+		GuestsAttended int `db:"guests_attended" json:"guests_attended"`
+	}
+	query := `SELECT
+			count(*) FILTER (WHERE status = 'confirmed') AS registered,
+			count(*) FILTER (WHERE status = 'confirmed' AND checked_in_at IS NOT NULL) AS attended,
+			count(*) FILTER (WHERE status = 'waitlisted') AS waitlisted,
+			count(*) FILTER (WHERE status = 'cancelled') AS cancelled,
+			count(*) FILTER (WHERE status = 'pending') AS pending,
+			count(*) FILTER (WHERE status = 'rejected') AS rejected
+		FROM registrations WHERE event_id = $1`
+	if err := db.Get(&report, query, eventID); err != nil {
+		log.Printf("Error building attendance report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build attendance report"})
+		return
+	}
+	query = `SELECT count(*) AS guests, count(g.checked_in_at) AS guests_attended
+		FROM registration_guests g JOIN registrations r ON r.id = g.registration_id
+		WHERE r.event_id = $1 AND r.status = 'confirmed'`
+	if err := db.Get(&report, query, eventID); err != nil {
+		log.Printf("Error building attendance report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build attendance report"})
+		return
+	}
+
+	rate := 0.0
+	if report.Registered > 0 {
+		rate = float64(report.Attended) / float64(report.Registered)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"event_id":        event.ID,
+		"name":            event.Name,
+		"registered":      report.Registered,
+		"attended":        report.Attended,
+		"no_shows":        report.Registered - report.Attended,
+		"waitlisted":      report.Waitlisted,
+		"cancelled":       report.Cancelled,
+		"pending":         report.Pending,
+		"rejected":        report.Rejected,
+		"guests":          report.Guests,
+		"guests_attended": report.GuestsAttended,
+		"attendance_rate": rate,
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// currentUserID resolves the authenticated username to its id. On failure it
+// writes the error response and returns false.
+func currentUserID(c *gin.Context, db *sqlx.DB) (int, bool) {
+	username, exists := c.Get("username")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, false
+	}
+
+	var id int
+	query := "SELECT id FROM users WHERE username = $1"
+	if err := db.GetContext(c.Request.Context(), &id, query, username); err != nil {
+		log.Printf("Error fetching user: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to fetch user"})
+		return 0, false
+	}
+	return id, true
+}
+
+// idParam parses a numeric path parameter. On failure it writes the error
+// response and returns false.
+func idParam(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return id, true
+}
+
+// optionalUserID resolves the user on routes open to anonymous requests,
+// returning zero for those. On failure it writes the error response and
+// returns false.
+func optionalUserID(c *gin.Context, db *sqlx.DB) (int, bool) {
+	if _, exists := c.Get("username"); !exists {
+		return 0, true
+	}
+	return currentUserID(c, db)
+}
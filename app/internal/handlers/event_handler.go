@@ -1,17 +1,25 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"homework/app/internal/broker"
 	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"homework/app/internal/recurrence"
+	"homework/app/internal/webhooks"
 	"log"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/jmoiron/sqlx"
 )
 
-const timeFormat = "15:04"
-const dateFormat = "02-01-06"
+// eventColumns lists every column of events, for queries that load whole rows.
+const eventColumns = "id, name, description, location, start_time, end_time, date_event, participant_count, created_by, capacity, series_id, occurrence_date, detached, cancelled_at, requires_approval, transfers_enabled, visibility, status, published_at"
 
 func CreateEvent(c *gin.Context, db *sqlx.DB) {
 	username := c.MustGet("username").(string)
@@ -23,32 +31,80 @@ func CreateEvent(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
-	parsedStartTime, err := time.Parse(timeFormat, payload.StartTime)
+	var user models.User
+
+	query := "SELECT id FROM users WHERE username =$1"
+	db.Get(&user, query, username)
+
+	event, err := eventFromPayload(payload, user.ID)
 	if err != nil {
-		log.Printf("Error parsing start time: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format"})
+		log.Printf("Error validating event: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	parsedEndTime, err := time.Parse(timeFormat, payload.EndTime)
+	tx, err := db.Beginx()
 	if err != nil {
-		log.Printf("Error parsing end time: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
 		return
 	}
+	defer tx.Rollback()
 
-	parsedDate, err := time.Parse(dateFormat, payload.Date)
-	if err != nil {
-		log.Printf("Error parsing date: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+	if err := insertEvent(c.Request.Context(), tx, &event); err != nil {
+		log.Printf("Failed to create event %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
 		return
 	}
 
-	var user models.User
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
 
-	query := "SELECT id FROM users WHERE username =$1"
-	db.Get(&user, query, username)
-	event := models.Event{
+	log.Printf("event successfully created %v\n", event)
+	c.JSON(http.StatusCreated, gin.H{"message": "Event created successfully", "event_id": event.ID, "status": event.Status})
+}
+
+var (
+	errInvalidStartTime = errors.New("Invalid start time format")
+	errInvalidEndTime   = errors.New("Invalid end time format")
+	errInvalidDate      = errors.New("Invalid date format")
+)
+
+// eventFromPayload applies the rules every new event must pass, whether it
+// comes from CreateEvent or from a bulk import.
+func eventFromPayload(payload models.CreateEventPayload, createdBy int) (models.Event, error) {
+	if err := binding.Validator.ValidateStruct(payload); err != nil {
+		return models.Event{}, err
+	}
+
+	parsedStartTime, err := time.Parse(models.TimeFormat, payload.StartTime)
+	if err != nil {
+		return models.Event{}, errInvalidStartTime
+	}
+
+	parsedEndTime, err := time.Parse(models.TimeFormat, payload.EndTime)
+	if err != nil {
+		return models.Event{}, errInvalidEndTime
+	}
+
+	parsedDate, err := time.Parse(models.DateFormat, payload.Date)
+	if err != nil {
+		return models.Event{}, errInvalidDate
+	}
+
+	visibility := payload.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+	status := models.EventDraft
+	var publishedAt *time.Time
+	if payload.Publish {
+		now := time.Now()
+		status, publishedAt = models.EventPublished, &now
+	}
+
+	return models.Event{
 		Name:             payload.Name,
 		Description:      payload.Description,
 		Location:         payload.Location,
@@ -56,26 +112,32 @@ func CreateEvent(c *gin.Context, db *sqlx.DB) {
 		EndTime:          parsedEndTime,
 		Date:             parsedDate,
 		ParticipantCount: 0,
-		CreatedBy:        user.ID,
-	}
-	query = "INSERT INTO events (name, description, location, start_time,end_time,participant_count,date_event,created_by) VALUES (:name, :description, :location, :start_time,:end_time,:participant_count,:date_event,:created_by) RETURNING id"
-	rows, err := db.NamedQuery(query, event)
+		CreatedBy:        createdBy,
+		Capacity:         payload.Capacity,
+		RequiresApproval: payload.RequiresApproval,
+		TransfersEnabled: payload.TransfersEnabled == nil || *payload.TransfersEnabled,
+		Visibility:       visibility,
+		Status:           status,
+		PublishedAt:      publishedAt,
+	}, nil
+}
+
+// insertEvent stores a new event, making its creator the owner, and
+// announces it to the organizer's webhooks.
+func insertEvent(ctx context.Context, tx *sqlx.Tx, event *models.Event) error {
+	query := "INSERT INTO events (name, description, location, start_time,end_time,participant_count,date_event,created_by,capacity,requires_approval,transfers_enabled,visibility,status,published_at) VALUES (:name, :description, :location, :start_time,:end_time,:participant_count,:date_event,:created_by,:capacity,:requires_approval,:transfers_enabled,:visibility,:status,:published_at) RETURNING id"
+	query, args, err := tx.BindNamed(query, event)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
-		log.Fatalf("Failed to create event %v", err)
-		return
+		return err
 	}
-	defer rows.Close()
-
-	if rows.Next() {
-		err := rows.Scan(&event.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event id"})
-			return
-		}
+	if err := tx.GetContext(ctx, &event.ID, query, args...); err != nil {
+		return err
 	}
-	log.Printf("event successfully created %v\n", event)
-	c.JSON(http.StatusCreated, gin.H{"message": "Event created successfully", "event_id": event.ID})
+	query = "INSERT INTO event_organizers (event_id, user_id, role) VALUES ($1, $2, 'owner')"
+	if _, err := tx.ExecContext(ctx, query, event.ID, event.CreatedBy); err != nil {
+		return err
+	}
+	return webhooks.PublishToOrganizers(ctx, tx, event.ID, webhooks.EventEventCreated, *event)
 }
 
 func HandleMyEvents(c *gin.Context, db *sqlx.DB) {
@@ -94,7 +156,7 @@ func HandleMyEvents(c *gin.Context, db *sqlx.DB) {
 	}
 
 	var events []models.Event
-	query = "SELECT id, name, description, location, start_time, end_time, date_event, participant_count, created_by FROM events WHERE created_by = $1"
+	query = "SELECT " + eventColumns + " FROM events WHERE id IN (SELECT event_id FROM event_organizers WHERE user_id = $1)"
 	err = db.Select(&events, query, user.ID)
 	if err != nil {
 		log.Printf("Error fetching events: %v", err)
@@ -105,3 +167,445 @@ func HandleMyEvents(c *gin.Context, db *sqlx.DB) {
 	c.JSON(http.StatusOK, events)
 
 }
+
+// HandleGetEvent returns an event to anyone who may see it. Private events
+// need an invite; the code of an invite link goes in the "invite" query
+// parameter.
+func HandleGetEvent(c *gin.Context, db *sqlx.DB) {
+	userID, ok := optionalUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	event, ok := requireEventAccess(c, db, eventID, userID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+func HandleUpdateEvent(c *gin.Context, db *sqlx.DB, hub broker.Broker, materializer *recurrence.Materializer) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	scope, ok := scopeQuery(c)
+	if !ok {
+		return
+	}
+
+	var payload models.UpdateEventPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if err := applyEventUpdate(payload, &models.Event{}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if payload.RRule != nil {
+		if scope == models.ScopeThis {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The recurrence rule can only be changed for following or all occurrences"})
+			return
+		}
+		if _, err := recurrence.ParseRule(*payload.RRule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if payload.Date != nil && scope != models.ScopeThis {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The date can only be changed for a single occurrence"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	event, ok := lockEventAsOrganizer(c, tx, eventID, userID, models.OrganizerEditor)
+	if !ok {
+		return
+	}
+	if event.Status == models.EventCancelled || event.Status == models.EventCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event is " + event.Status + " and can no longer be edited", "status": event.Status})
+		return
+	}
+	if scope != models.ScopeThis && event.SeriesID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event is not part of a recurring series"})
+		return
+	}
+	if scope != models.ScopeThis && !requireSeriesRole(c, tx, event, scope, userID, models.OrganizerEditor) {
+		return
+	}
+	if payload.Capacity != nil {
+		taken, err := seatsTaken(c.Request.Context(), tx, event, scope)
+		if err != nil {
+			log.Printf("Error fetching participant count: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+			return
+		}
+		if *payload.Capacity < taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "Capacity cannot be lower than the seats already taken", "participant_count": taken})
+			return
+		}
+	}
+
+	if scope != models.ScopeThis {
+		changed, err := updateSeries(c.Request.Context(), tx, materializer, event, scope, payload)
+		if err != nil {
+			log.Printf("Error updating event series: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+		for _, changedEvent := range changed {
+			publishEventState(c.Request.Context(), db, hub, changedEvent.ID)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Events updated successfully", "events": changed})
+		return
+	}
+
+	applyEventUpdate(payload, &event)
+	// An occurrence edited on its own keeps its changes when the series is.
+	event.Detached = event.SeriesID != nil
+
+	query := "UPDATE events SET name = :name, description = :description, location = :location, start_time = :start_time, end_time = :end_time, date_event = :date_event, capacity = :capacity, requires_approval = :requires_approval, transfers_enabled = :transfers_enabled, visibility = :visibility, detached = :detached WHERE id = :id"
+	if _, err := tx.NamedExec(query, event); err != nil {
+		log.Printf("Error updating event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+		return
+	}
+
+	if err := announceEventUpdate(c.Request.Context(), tx, event); err != nil {
+		log.Printf("Error announcing event update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	publishEventState(c.Request.Context(), db, hub, event.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event updated successfully", "event": event})
+}
+
+// seatsTaken is the most seats taken on any occurrence an edit with scope
+// changes the capacity of. It locks the other occurrences so their counts
+// hold until the edit commits; the caller must hold the event row lock.
+func seatsTaken(ctx context.Context, tx *sqlx.Tx, event models.Event, scope string) (int, error) {
+	if scope == models.ScopeThis {
+		return event.ParticipantCount, nil
+	}
+	var counts []int
+	query := `SELECT participant_count FROM events
+		WHERE series_id = $1 AND occurrence_date >= $2 AND NOT detached AND status IN ('draft', 'published')
+		ORDER BY id FOR UPDATE`
+	if err := tx.SelectContext(ctx, &counts, query, *event.SeriesID, seriesFrom(event, scope)); err != nil {
+		return 0, err
+	}
+	taken := 0
+	for _, count := range counts {
+		taken = max(taken, count)
+	}
+	return taken, nil
+}
+
+// applyEventUpdate copies the fields present in payload onto event.
+func applyEventUpdate(payload models.UpdateEventPayload, event *models.Event) error {
+	var err error
+	if payload.Name != nil {
+		event.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		event.Description = *payload.Description
+	}
+	if payload.Location != nil {
+		event.Location = *payload.Location
+	}
+	if payload.StartTime != nil {
+		if event.StartTime, err = time.Parse(models.TimeFormat, *payload.StartTime); err != nil {
+			return errInvalidStartTime
+		}
+	}
+	if payload.EndTime != nil {
+		if event.EndTime, err = time.Parse(models.TimeFormat, *payload.EndTime); err != nil {
+			return errInvalidEndTime
+		}
+	}
+	if payload.Date != nil {
+		if event.Date, err = time.Parse(models.DateFormat, *payload.Date); err != nil {
+			return errInvalidDate
+		}
+	}
+	if payload.Capacity != nil {
+		event.Capacity = payload.Capacity
+	}
+	if payload.RequiresApproval != nil {
+		event.RequiresApproval = *payload.RequiresApproval
+	}
+	if payload.TransfersEnabled != nil {
+		event.TransfersEnabled = *payload.TransfersEnabled
+	}
+	if payload.Visibility != nil {
+		event.Visibility = *payload.Visibility
+	}
+	return nil
+}
+
+// announceEventUpdate tells webhooks and registrants about a changed event
+// and fills any seats a raised capacity freed. The caller must hold the
+// event row lock.
+func announceEventUpdate(ctx context.Context, tx *sqlx.Tx, event models.Event) error {
+	if err := webhooks.PublishToOrganizers(ctx, tx, event.ID, webhooks.EventEventUpdated, event); err != nil {
+		return err
+	}
+	if err := notifications.NotifyRegistrants(ctx, tx, event.ID, notifications.KindEventUpdated,
+		event.Name+" was updated", "The organizer changed the details of this event."); err != nil {
+		return err
+	}
+	return promoteWaitlisted(ctx, tx, event.ID)
+}
+
+func HandleCancelEvent(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	scope, ok := scopeQuery(c)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	event, ok := lockEventAsOrganizer(c, tx, eventID, userID, models.OrganizerOwner)
+	if !ok {
+		return
+	}
+	if !transitionAllowed(c, event, models.EventCancelled) {
+		return
+	}
+
+	var cancelled []models.Event
+	if scope == models.ScopeThis {
+		event, err = cancelEvent(c.Request.Context(), tx, event.ID)
+		cancelled = append(cancelled, event)
+	} else if event.SeriesID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event is not part of a recurring series"})
+		return
+	} else if !requireSeriesRole(c, tx, event, scope, userID, models.OrganizerOwner) {
+		return
+	} else {
+		cancelled, err = cancelSeries(c.Request.Context(), tx, event, scope)
+	}
+	if err != nil {
+		log.Printf("Error cancelling event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	for _, cancelledEvent := range cancelled {
+		publishEventState(c.Request.Context(), db, hub, cancelledEvent.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event cancelled successfully", "events": cancelled})
+}
+
+// cancelEvent marks an event cancelled, keeping its registrations, refunds
+// what was paid for it in full and tells webhooks and registrants. The
+// caller must hold the event row lock.
+func cancelEvent(ctx context.Context, tx *sqlx.Tx, eventID int) (models.Event, error) {
+	var event models.Event
+	query := "UPDATE events SET status = 'cancelled', cancelled_at = now() WHERE id = $1 RETURNING " + eventColumns
+	if err := tx.GetContext(ctx, &event, query, eventID); err != nil {
+		return event, err
+	}
+	if err := refundCancelledEvent(ctx, tx, event.ID); err != nil {
+		return event, err
+	}
+	if err := webhooks.PublishToOrganizers(ctx, tx, event.ID, webhooks.EventEventUpdated, event); err != nil {
+		return event, err
+	}
+	err := notifications.NotifyRegistrants(ctx, tx, event.ID, notifications.KindEventCancelled,
+		event.Name+" was cancelled", "The organizer cancelled this event. Anything you paid is refunded in full.")
+	return event, err
+}
+
+// eventTransitions lists the statuses each status may move to.
+var eventTransitions = map[string][]string{
+	models.EventDraft:     {models.EventPublished, models.EventCancelled},
+	models.EventPublished: {models.EventCompleted, models.EventCancelled},
+}
+
+// transitionAllowed reports whether event may move to status. If not it
+// writes the error response.
+func transitionAllowed(c *gin.Context, event models.Event, status string) bool {
+	if slices.Contains(eventTransitions[event.Status], status) {
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "Event is " + event.Status + " and cannot become " + status, "status": event.Status})
+	return false
+}
+
+// HandlePublishEvent makes a draft live. With the following or all scope it
+// publishes the series, so later occurrences are live when materialized,
+// and its draft occurrences within scope.
+func HandlePublishEvent(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	scope, ok := scopeQuery(c)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	event, ok := lockEventAsOrganizer(c, tx, eventID, userID, models.OrganizerEditor)
+	if !ok {
+		return
+	}
+
+	var published []models.Event
+	if scope == models.ScopeThis {
+		if !transitionAllowed(c, event, models.EventPublished) {
+			return
+		}
+		event, err = publishEvent(c.Request.Context(), tx, event.ID)
+		published = append(published, event)
+	} else if event.SeriesID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event is not part of a recurring series"})
+		return
+	} else if !requireSeriesRole(c, tx, event, scope, userID, models.OrganizerEditor) {
+		return
+	} else {
+		published, err = publishSeries(c.Request.Context(), tx, event, scope)
+	}
+	if err != nil {
+		log.Printf("Error publishing event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	for _, publishedEvent := range published {
+		publishEventState(c.Request.Context(), db, hub, publishedEvent.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event published successfully", "events": published})
+}
+
+// publishEvent opens a draft for registration and tells webhooks. The
+// caller must hold the event row lock.
+func publishEvent(ctx context.Context, tx *sqlx.Tx, eventID int) (models.Event, error) {
+	var event models.Event
+	query := "UPDATE events SET status = 'published', published_at = now() WHERE id = $1 RETURNING " + eventColumns
+	if err := tx.GetContext(ctx, &event, query, eventID); err != nil {
+		return event, err
+	}
+	err := webhooks.PublishToOrganizers(ctx, tx, event.ID, webhooks.EventEventPublished, event)
+	return event, err
+}
+
+// HandleCompleteEvent marks a published event that has started as having
+// taken place, which closes it for registration. Its registrations and
+// check-ins are kept as they are.
+func HandleCompleteEvent(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	event, ok := lockEventAsOrganizer(c, tx, eventID, userID, models.OrganizerEditor)
+	if !ok {
+		return
+	}
+	if !transitionAllowed(c, event, models.EventCompleted) {
+		return
+	}
+
+	var started bool
+	query := "SELECT date_event + start_time::time <= now() at time zone 'utc' FROM events WHERE id = $1"
+	if err := tx.Get(&started, query, eventID); err != nil {
+		log.Printf("Error checking event start: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete event"})
+		return
+	}
+	if !started {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has not started yet"})
+		return
+	}
+
+	query = "UPDATE events SET status = 'completed' WHERE id = $1 RETURNING " + eventColumns
+	if err := tx.Get(&event, query, eventID); err != nil {
+		log.Printf("Error completing event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete event"})
+		return
+	}
+	if err := webhooks.PublishToOrganizers(c.Request.Context(), tx, event.ID, webhooks.EventEventUpdated, event); err != nil {
+		log.Printf("Error publishing webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	publishEventState(c.Request.Context(), db, hub, event.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event completed", "event": event})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCancellingEventRefundsPaidRegistrationsOnce(t *testing.T) {
+	db := testDB(t)
+	hub := broker.NewLocal()
+	owner := createUser(t, db, "owner")
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	event := createEvent(t, db, owner, intPtr(10))
+	path := "/events/" + strconv.Itoa(event.ID)
+
+	// Cancellations by the organizer are refunded in full, whatever the
+	// policy says.
+	setPolicy := func(c *gin.Context) { HandleSetRefundPolicy(c, db) }
+	policy := gin.H{"full_refund_days": 0, "partial_refund_days": 0, "partial_refund_percent": 0}
+	expectStatus(t, perform(t, setPolicy, "owner", http.MethodPut, "/events/:id/refund-policy", path+"/refund-policy", policy), http.StatusOK)
+
+	paid := payForSeat(t, db, event.ID, alice)
+	registerFor(t, db, hub, "bob", event.ID)
+
+	cancel := func(c *gin.Context) { HandleCancelEvent(c, db, hub) }
+	expectStatus(t, perform(t, cancel, "owner", http.MethodPost, "/events/:id/cancel", path+"/cancel", nil), http.StatusOK)
+
+	if refund := loadRegistration(t, db, paid.ID).RefundAmount; refund != paid.Amount {
+		t.Fatalf("refund_amount = %d, want the full %d", refund, paid.Amount)
+	}
+	var bobRefund int64
+	if err := db.Get(&bobRefund, "SELECT refund_amount FROM registrations WHERE event_id = $1 AND participant_id = $2", event.ID, bob); err != nil || bobRefund != 0 {
+		t.Fatalf("free registration refund = %d (err %v), want 0", bobRefund, err)
+	}
+	if n := countRows(t, db, "SELECT count(*) FROM jobs WHERE kind = $1", jobRefund); n != 1 {
+		t.Fatalf("%d refunds scheduled, want 1", n)
+	}
+
+	// Neither the participant nor a second cancellation may refund again.
+	expectStatus(t, cancelFor(t, db, hub, "alice", event.ID), http.StatusConflict)
+	expectStatus(t, perform(t, cancel, "owner", http.MethodPost, "/events/:id/cancel", path+"/cancel", nil), http.StatusConflict)
+	if n := countRows(t, db, "SELECT count(*) FROM jobs WHERE kind = $1", jobRefund); n != 1 {
+		t.Fatalf("%d refunds scheduled after retries, want 1", n)
+	}
+	if status := loadRegistration(t, db, paid.ID).Status; status != models.RegistrationConfirmed {
+		t.Errorf("registration = %s, want left confirmed for the refund to settle", status)
+	}
+}
+
+func TestCapacityCannotDropBelowSeatsTaken(t *testing.T) {
+	db := testDB(t)
+	hub := broker.NewLocal()
+	owner := createUser(t, db, "owner")
+	createUser(t, db, "alice")
+	createUser(t, db, "bob")
+	event := createEvent(t, db, owner, intPtr(10))
+	path := "/events/" + strconv.Itoa(event.ID)
+	registerFor(t, db, hub, "alice", event.ID)
+	registerFor(t, db, hub, "bob", event.ID)
+
+	update := func(c *gin.Context) { HandleUpdateEvent(c, db, hub, nil) }
+	expectStatus(t, perform(t, update, "owner", http.MethodPut, "/events/:id", path, gin.H{"capacity": 1}), http.StatusConflict)
+	expectStatus(t, perform(t, update, "owner", http.MethodPut, "/events/:id", path, gin.H{"capacity": 2}), http.StatusOK)
+	if n := participantCount(t, db, event.ID); n != 2 {
+		t.Errorf("participant_count = %d, want 2", n)
+	}
+}
+
+func TestEventLifecycle(t *testing.T) {
+	statuses := []string{models.EventDraft, models.EventPublished, models.EventCompleted, models.EventCancelled}
+	allowed := map[[2]string]bool{
+		{models.EventDraft, models.EventPublished}:     true,
+		{models.EventDraft, models.EventCancelled}:     true,
+		{models.EventPublished, models.EventCompleted}: true,
+		{models.EventPublished, models.EventCancelled}: true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			got := transitionAllowed(c, models.Event{Status: from}, to)
+			if want := allowed[[2]string{from, to}]; got != want {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, want)
+			} else if !got && w.Code != http.StatusConflict {
+				t.Errorf("%s -> %s refused with status %d, want 409", from, to, w.Code)
+			}
+		}
+	}
+}
+
+func TestRegistrationOpen(t *testing.T) {
+	tests := []struct {
+		status string
+		open   bool
+		code   int
+	}{
+		{models.EventPublished, true, http.StatusOK},
+		{models.EventDraft, false, http.StatusBadRequest},
+		{models.EventCancelled, false, http.StatusConflict},
+		{models.EventCompleted, false, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		if got := registrationOpen(c, models.Event{Status: tt.status}); got != tt.open || w.Code != tt.code {
+			t.Errorf("registrationOpen(%s) = %v with status %d, want %v with %d", tt.status, got, w.Code, tt.open, tt.code)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"homework/app/internal/export"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var attendeeExportHeader = []any{"registration_id", "username", "email", "registration_date", "status", "ticket_type", "quantity", "checked_in", "checked_in_at", "guests"}
+
+type attendeeRow struct {
+	RegistrationID   int        `db:"id"`
+	Username         string     `db:"username"`
+	Email            string     `db:"email"`
+	RegistrationDate time.Time  `db:"registration_date"`
+	Status           string     `db:"status"`
+	TicketType       string     `db:"ticket_type"`
+	Quantity         int        `db:"quantity"`
+	CheckedInAt      *time.Time `db:"checked_in_at"`
+	Guests           string     `db:"guests"`
+	Answers          []byte     `db:"answers"`
+}
+
+func HandleExportRegistrations(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", export.FormatCSV)
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	// Every question of the form gets a column after the fixed ones.
+	questions, err := loadQuestions(c.Request.Context(), db, eventID)
+	if err != nil {
+		log.Printf("Error fetching questions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export registrations"})
+		return
+	}
+	header := slices.Clone(attendeeExportHeader)
+	for _, question := range questions {
+		header = append(header, question.Label)
+	}
+
+	query := `SELECT r.id, u.username, u.email, r.registration_date, r.status, COALESCE(t.name, '') AS ticket_type, r.quantity, r.checked_in_at,
+			(SELECT COALESCE(string_agg(g.name || ' <' || g.email || '>', '; ' ORDER BY g.id), '') FROM registration_guests g WHERE g.registration_id = r.id) AS guests,
+			(SELECT COALESCE(jsonb_object_agg(a.question_id, a.value), '{}') FROM registration_answers a WHERE a.registration_id = r.id) AS answers
+		FROM registrations r
+		JOIN users u ON u.id = r.participant_id
+		LEFT JOIN ticket_types t ON t.id = r.ticket_type_id
+		WHERE r.event_id = $1
+		ORDER BY r.id`
+	rows, err := db.QueryxContext(c.Request.Context(), query, eventID)
+	if err != nil {
+		log.Printf("Error exporting registrations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export registrations"})
+		return
+	}
+	defer rows.Close()
+
+	w, err := export.New(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	defer func() {
+		if err := w.Close(); err != nil {
+			log.Printf("Error finishing export: %v", err)
+		}
+	}()
+
+	// From here on the body is being streamed, so errors can only be logged.
+	c.Header("Content-Type", w.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="event-%d-registrations.%s"`, eventID, format))
+	c.Status(http.StatusOK)
+
+	if err := w.WriteRow(header); err != nil {
+		log.Printf("Error writing export: %v", err)
+		return
+	}
+	for rows.Next() {
+		var row attendeeRow
+		if err := rows.StructScan(&row); err != nil {
+			log.Printf("Error reading registration for export: %v", err)
+			return
+		}
+		record := []any{row.RegistrationID, row.Username, row.Email, row.RegistrationDate.Format("2006-01-02"),
+			row.Status, row.TicketType, row.Quantity, row.CheckedInAt != nil, row.CheckedInAt, row.Guests}
+		var answers map[int]json.RawMessage
+		if err := json.Unmarshal(row.Answers, &answers); err != nil {
+			log.Printf("Error reading answers for export: %v", err)
+			return
+		}
+		for _, question := range questions {
+			record = append(record, exportAnswer(answers[question.ID]))
+		}
+		if err := w.WriteRow(record); err != nil {
+			log.Printf("Error writing export: %v", err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error reading registrations for export: %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"homework/app/internal/models"
+	"homework/app/internal/tickets"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const guestColumns = "id, registration_id, name, email, ticket_nonce, checked_in_at, checked_in_by, created_at"
+
+// insertGuests names guests on a new registration.
+func insertGuests(ctx context.Context, tx *sqlx.Tx, registrationID int, payloads []models.GuestPayload) ([]models.Guest, error) {
+	guests := []models.Guest{}
+	query := "INSERT INTO registration_guests (registration_id, name, email) VALUES ($1, $2, $3) RETURNING " + guestColumns
+	for _, payload := range payloads {
+		var guest models.Guest
+		if err := tx.GetContext(ctx, &guest, query, registrationID, payload.Name, payload.Email); err != nil {
+			return nil, err
+		}
+		guests = append(guests, guest)
+	}
+	return guests, nil
+}
+
+// ownRegistration loads a registration of the user, locking its row if
+// lock is set. Registrations of anyone else are reported as missing. On
+// failure it writes the error response and returns false.
+func ownRegistration(c *gin.Context, db sqlx.Queryer, registrationID, userID int, lock bool) (models.Registration, bool) {
+	var registration models.Registration
+	query := "SELECT " + registrationPaymentColumns + ", ticket_nonce, checked_in_at FROM registrations WHERE id = $1"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	err := sqlx.Get(db, &registration, query, registrationID)
+	if err == sql.ErrNoRows || (err == nil && registration.ParticipantID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return registration, false
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch registration"})
+		return registration, false
+	}
+	return registration, true
+}
+
+// activeRegistration reports whether a registration still holds or awaits
+// seats, so its guests may be changed.
+func activeRegistration(registration models.Registration) bool {
+	switch registration.Status {
+	case models.RegistrationCancelled, models.RegistrationExpired, models.RegistrationRejected:
+		return false
+	}
+	return true
+}
+
+func HandleListGuests(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	registration, ok := ownRegistration(c, db, registrationID, userID, false)
+	if !ok {
+		return
+	}
+
+	guests := []models.Guest{}
+	query := "SELECT " + guestColumns + " FROM registration_guests WHERE registration_id = $1 ORDER BY id"
+	if err := db.Select(&guests, query, registrationID); err != nil {
+		log.Printf("Error fetching guests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch guests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registration_id": registration.ID, "quantity": registration.Quantity, "guests": guests})
+}
+
+// HandleAddGuest names a guest for one of the registration's unnamed seats.
+func HandleAddGuest(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var payload models.GuestPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the registration serialises guest changes against its seats.
+	registration, ok := ownRegistration(c, tx, registrationID, userID, true)
+	if !ok {
+		return
+	}
+	if !activeRegistration(registration) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration is no longer active", "status": registration.Status})
+		return
+	}
+
+	var named int
+	if err := tx.Get(&named, "SELECT count(*) FROM registration_guests WHERE registration_id = $1", registrationID); err != nil {
+		log.Printf("Error counting guests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add guest"})
+		return
+	}
+	if named+1 >= registration.Quantity {
+		c.JSON(http.StatusConflict, gin.H{"error": "Every seat of this registration already has a guest"})
+		return
+	}
+
+	guests, err := insertGuests(c.Request.Context(), tx, registrationID, []models.GuestPayload{payload})
+	if err != nil {
+		log.Printf("Error adding guest: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add guest"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, guests[0])
+}
+
+// HandleUpdateGuest gives a guest's seat to someone else or corrects their
+// details. The guest's ticket is reissued, revoking the old code.
+func HandleUpdateGuest(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	guestID, ok := idParam(c, "guest_id")
+	if !ok {
+		return
+	}
+
+	var payload models.GuestPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	registration, ok := ownRegistration(c, db, registrationID, userID, false)
+	if !ok {
+		return
+	}
+	if !activeRegistration(registration) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration is no longer active", "status": registration.Status})
+		return
+	}
+
+	var guest models.Guest
+	query := `UPDATE registration_guests SET name = $1, email = $2, ticket_nonce = md5(random()::text || clock_timestamp()::text)
+		WHERE id = $3 AND registration_id = $4 AND checked_in_at IS NULL
+		RETURNING ` + guestColumns
+	err := db.Get(&guest, query, payload.Name, payload.Email, guestID, registrationID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found or already checked in"})
+		return
+	} else if err != nil {
+		log.Printf("Error updating guest: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update guest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, guest)
+}
+
+// HandleRemoveGuest revokes a guest's ticket. The seat stays with the
+// registration and can be given to a new guest.
+func HandleRemoveGuest(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	guestID, ok := idParam(c, "guest_id")
+	if !ok {
+		return
+	}
+	if _, ok := ownRegistration(c, db, registrationID, userID, false); !ok {
+		return
+	}
+
+	query := "DELETE FROM registration_guests WHERE id = $1 AND registration_id = $2 AND checked_in_at IS NULL"
+	result, err := db.Exec(query, guestID, registrationID)
+	if err != nil {
+		log.Printf("Error removing guest: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove guest"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found or already checked in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Guest removed"})
+}
+
+// HandleGuestTicket returns the ticket of a guest for the participant to
+// pass on.
+func HandleGuestTicket(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	guestID, ok := idParam(c, "guest_id")
+	if !ok {
+		return
+	}
+	registration, ok := ownRegistration(c, db, registrationID, userID, false)
+	if !ok {
+		return
+	}
+	if registration.Status != models.RegistrationConfirmed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only confirmed registrations have a ticket", "status": registration.Status})
+		return
+	}
+
+	var guest models.Guest
+	query := "SELECT " + guestColumns + " FROM registration_guests WHERE id = $1 AND registration_id = $2"
+	if err := db.Get(&guest, query, guestID, registrationID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching guest: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch guest"})
+		return
+	}
+
+	ticket := tickets.Ticket{RegistrationID: registration.ID, GuestID: guest.ID, EventID: registration.EventID, Nonce: guest.TicketNonce}
+	writeTicket(c, ticket, gin.H{"registration_id": registration.ID, "guest_id": guest.ID, "name": guest.Name, "event_id": registration.EventID})
+}
+
+// checkInGuest admits the guest a verified ticket names and commits tx.
+func checkInGuest(c *gin.Context, tx *sqlx.Tx, userID int, ticket tickets.Ticket) {
+	var guest models.Guest
+	var status string
+	query := `SELECT g.id, g.registration_id, g.name, g.email, g.ticket_nonce, g.checked_in_at, g.checked_in_by, g.created_at, r.status
+		FROM registration_guests g JOIN registrations r ON r.id = g.registration_id
+		WHERE g.id = $1 AND g.registration_id = $2 AND r.event_id = $3
+		FOR UPDATE OF g`
+	err := tx.QueryRowx(query, ticket.GuestID, ticket.RegistrationID, ticket.EventID).Scan(&guest.ID, &guest.RegistrationID, &guest.Name,
+		&guest.Email, &guest.TicketNonce, &guest.CheckedInAt, &guest.CheckedInBy, &guest.CreatedAt, &status)
+	if err == sql.ErrNoRows || (err == nil && guest.TicketNonce != ticket.Nonce) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching guest: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+	if status != models.RegistrationConfirmed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration is not confirmed", "status": status})
+		return
+	}
+	if guest.CheckedInAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ticket already checked in", "checked_in_at": guest.CheckedInAt})
+		return
+	}
+
+	query = "UPDATE registration_guests SET checked_in_at = now(), checked_in_by = $1 WHERE id = $2 RETURNING checked_in_at, checked_in_by"
+	if err := tx.QueryRowx(query, userID, guest.ID).Scan(&guest.CheckedInAt, &guest.CheckedInBy); err != nil {
+		log.Printf("Error checking in guest: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Checked in", "guest": guest})
+}
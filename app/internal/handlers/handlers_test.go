@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"homework/app/internal/models"
+	"homework/app/internal/storage/storagetest"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testDB returns a migrated database, skipping the test without one.
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	return storagetest.New(t)
+}
+
+func createUser(t *testing.T, db *sqlx.DB, username string) int {
+	t.Helper()
+	var id int
+	query := "INSERT INTO users (username, email, password_hash) VALUES ($1, $2, '') RETURNING id"
+	if err := db.Get(&id, query, username, username+"@example.com"); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return id
+}
+
+// createEvent stores a published public event a week from now, owned by
+// ownerID.
+func createEvent(t *testing.T, db *sqlx.DB, ownerID int, capacity *int) models.Event {
+	t.Helper()
+	now := time.Now()
+	start := now.Add(7 * 24 * time.Hour).Truncate(time.Hour)
+	event := models.Event{
+		Name:             "Meetup",
+		Description:      "A meetup",
+		Location:         "Hall",
+		StartTime:        start,
+		EndTime:          start.Add(2 * time.Hour),
+		Date:             start,
+		CreatedBy:        ownerID,
+		Capacity:         capacity,
+		TransfersEnabled: true,
+		Visibility:       models.VisibilityPublic,
+		Status:           models.EventPublished,
+		PublishedAt:      &now,
+	}
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	if err := insertEvent(context.Background(), tx, &event); err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// perform runs handler for a request to path, routed through pattern, as
+// username; an empty username makes the request anonymous.
+func perform(t *testing.T, handler gin.HandlerFunc, username, method, pattern, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.Handle(method, pattern, func(c *gin.Context) {
+		if username != "" {
+			c.Set("username", username)
+		}
+		handler(c)
+	})
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, status, w.Body.String())
+	}
+}
+
+func decode(t *testing.T, body []byte) map[string]any {
+	t.Helper()
+	var v map[string]any
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return v
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"homework/app/internal/storage"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown makes /readyz fail so load balancers stop routing
+// traffic to this instance while in-flight requests drain.
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+func HandleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func HandleReadyz(c *gin.Context, db *sqlx.DB, timeout time.Duration) {
+	if shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		log.Printf("Readiness check: database unreachable: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "database": "unreachable"})
+		return
+	}
+
+	version, err := storage.MigrationVersion(ctx, db)
+	if err != nil {
+		log.Printf("Readiness check: failed to read migration version: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "migrations": "unknown"})
+		return
+	}
+	if version != storage.ExpectedMigrationVersion {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":             "unavailable",
+			"migration_version":  version,
+			"expected_migration": storage.ExpectedMigrationVersion,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "migration_version": version})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"homework/app/internal/importer"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const maxImportFileSize = 5 << 20
+
+type importRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// HandleImportEvents creates events from an uploaded CSV or iCalendar file
+// (multipart field "file"; see package importer for the column mapping).
+// Every row is validated like CreateEvent. With dry_run=true nothing is
+// written; otherwise all valid rows are inserted in one transaction and the
+// invalid ones are reported. Imported events are drafts unless publish=true.
+func HandleImportEvents(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	publish := c.Query("publish") == "true"
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file of at most 5 MB is required in the \"file\" field"})
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	}
+	if format != importer.FormatCSV && format != importer.FormatICS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload a .csv or .ics file, or set format=csv|ics"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	defer file.Close()
+
+	rows, err := importer.Parse(format, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse file", "details": err.Error()})
+		return
+	}
+
+	rowErrors := []importRowError{}
+	var valid []models.Event
+	for _, row := range rows {
+		if row.Err != nil {
+			rowErrors = append(rowErrors, importRowError{Line: row.Line, Error: row.Err.Error()})
+			continue
+		}
+		row.Payload.Publish = publish
+		event, err := eventFromPayload(row.Payload, userID)
+		if err != nil {
+			rowErrors = append(rowErrors, importRowError{Line: row.Line, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, event)
+	}
+
+	result := gin.H{
+		"dry_run": dryRun,
+		"total":   len(rows),
+		"valid":   len(valid),
+		"invalid": len(rowErrors),
+		"errors":  rowErrors,
+	}
+	if dryRun || len(valid) == 0 {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	eventIDs := make([]int, 0, len(valid))
+	for i := range valid {
+		if err := insertEvent(c.Request.Context(), tx, &valid[i]); err != nil {
+			log.Printf("Error importing event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import events"})
+			return
+		}
+		eventIDs = append(eventIDs, valid[i].ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	result["event_ids"] = eventIDs
+	c.JSON(http.StatusCreated, result)
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"homework/app/internal/invites"
+	"homework/app/internal/jobs"
+	"homework/app/internal/mailer"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const inviteLinkColumns = "id, event_id, nonce, expires_at, max_uses, uses, created_by, created_at, revoked_at"
+
+const inviteColumns = "id, event_id, email, nonce, invited_by, created_at, used_by, used_at"
+
+// inviteLinkValid matches the link $1 of event $2 with nonce $3 while it is
+// neither revoked nor expired.
+const inviteLinkValid = "id = $1 AND event_id = $2 AND nonce = $3 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())"
+
+// emailInviteValid matches the email invite $1 of event $2 with nonce $3
+// while it is unused or was redeemed by user $4.
+const emailInviteValid = "id = $1 AND event_id = $2 AND nonce = $3 AND (used_at IS NULL OR used_by = $4)"
+
+// requireEventAccess loads an event the user may see: any public or
+// unlisted event, and private events they organize, are registered for,
+// redeemed an email invite to or hold the invite code of in the "invite"
+// query parameter. Drafts are seen only by their organizer. Other events are
+// reported as missing. userID is zero for anonymous requests. On failure it
+// writes the error response and returns false.
+func requireEventAccess(c *gin.Context, db *sqlx.DB, eventID, userID int) (models.Event, bool) {
+	var event models.Event
+	query := "SELECT " + eventColumns + " FROM events WHERE id = $1"
+	err := db.Get(&event, query, eventID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return event, false
+	} else if err != nil {
+		log.Printf("Error fetching event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return event, false
+	}
+
+	allowed, err := canViewEvent(c.Request.Context(), db, event, userID, c.Query("invite"))
+	if err != nil {
+		log.Printf("Error checking event access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return event, false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return event, false
+	}
+	return event, true
+}
+
+const jobSendInvite = "invite.send"
+
+type sendInviteJob struct {
+	InviteID int `json:"invite_id"`
+}
+
+// RegisterInviteJobs installs the job that mails email invites on runner.
+func RegisterInviteJobs(runner *jobs.Runner, db *sqlx.DB, mail mailer.Mailer) {
+	runner.Register(jobSendInvite, func(ctx context.Context, job jobs.Job) error {
+		var p sendInviteJob
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return err
+		}
+		return sendInvite(ctx, db, mail, p.InviteID)
+	})
+}
+
+// sendInvite mails an email invite its code. Invites withdrawn or redeemed
+// in the meantime are not sent.
+func sendInvite(ctx context.Context, db *sqlx.DB, mail mailer.Mailer, inviteID int) error {
+	var invite struct {
+		models.Invite
+		EventName string `db:"event_name"`
+	}
+	query := `SELECT i.id, i.event_id, i.email, i.nonce, i.used_at, e.name AS event_name
+		FROM event_invites i JOIN events e ON e.id = i.event_id
+		WHERE i.id = $1`
+	err := db.GetContext(ctx, &invite, query, inviteID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && invite.UsedAt != nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	code := invites.Code(invites.Invite{Email: true, ID: invite.ID, EventID: invite.EventID, Nonce: invite.Nonce})
+	return mail.Send(ctx, mailer.Message{
+		To:      invite.Email,
+		Subject: "You are invited to " + invite.EventName,
+		Body: fmt.Sprintf("Hi,\n\nYou are invited to %s. Give this invite code when you view or register for the event:\n\n%s\n\nThe code can be redeemed by one account only.\n",
+			invite.EventName, code),
+	})
+}
+
+// canViewEvent reports whether userID, or whoever holds code, may see
+// event. A link that has been used up still shows the event; an email
+// invite shows it to anyone until it is redeemed, and then only to the
+// account that redeemed it.
+func canViewEvent(ctx context.Context, db sqlx.QueryerContext, event models.Event, userID int, code string) (bool, error) {
+	if userID != 0 {
+		organizer, err := isEventOrganizer(ctx, db, event.ID, userID)
+		if err != nil || organizer {
+			return organizer, err
+		}
+	}
+	switch {
+	case event.Status == models.EventDraft:
+		return false, nil
+	case event.Visibility != models.VisibilityPrivate:
+		return true, nil
+	}
+	if userID != 0 {
+		var allowed bool
+		query := `SELECT EXISTS (SELECT 1 FROM registrations WHERE event_id = $1 AND participant_id = $2)
+			OR EXISTS (SELECT 1 FROM event_invites WHERE event_id = $1 AND used_by = $2)`
+		if err := sqlx.GetContext(ctx, db, &allowed, query, event.ID, userID); err != nil || allowed {
+			return allowed, err
+		}
+	}
+
+	invite, err := invites.Parse(code)
+	if err != nil || invite.EventID != event.ID {
+		return false, nil
+	}
+	var valid bool
+	if invite.Email {
+		query := "SELECT EXISTS (SELECT 1 FROM event_invites WHERE " + emailInviteValid + ")"
+		err = sqlx.GetContext(ctx, db, &valid, query, invite.ID, invite.EventID, invite.Nonce, userID)
+		return valid, err
+	}
+	query := "SELECT EXISTS (SELECT 1 FROM event_invite_links WHERE " + inviteLinkValid + ")"
+	err = sqlx.GetContext(ctx, db, &valid, query, invite.ID, invite.EventID, invite.Nonce)
+	return valid, err
+}
+
+// admitToPrivateEvent reports whether participantID may register for the
+// private event: its organizers and those who redeemed an email invite to
+// it may, anyone else needs a valid invite code. Redeeming a code uses up
+// one use of a link, or ties an email invite to participantID for good.
+// The caller must hold the event row lock.
+func admitToPrivateEvent(ctx context.Context, tx *sqlx.Tx, event models.Event, participantID int, code string) (bool, error) {
+	if organizer, err := isEventOrganizer(ctx, tx, event.ID, participantID); err != nil || organizer {
+		return organizer, err
+	}
+	var invited bool
+	query := "SELECT EXISTS (SELECT 1 FROM event_invites WHERE event_id = $1 AND used_by = $2)"
+	if err := tx.GetContext(ctx, &invited, query, event.ID, participantID); err != nil || invited {
+		return invited, err
+	}
+
+	invite, err := invites.Parse(code)
+	if err != nil || invite.EventID != event.ID {
+		return false, nil
+	}
+	var result sql.Result
+	if invite.Email {
+		query = "UPDATE event_invites SET used_by = $4, used_at = COALESCE(used_at, now()) WHERE " + emailInviteValid
+		result, err = tx.ExecContext(ctx, query, invite.ID, invite.EventID, invite.Nonce, participantID)
+	} else {
+		query = "UPDATE event_invite_links SET uses = uses + 1 WHERE " + inviteLinkValid + " AND (max_uses IS NULL OR uses < max_uses)"
+		result, err = tx.ExecContext(ctx, query, invite.ID, invite.EventID, invite.Nonce)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func HandleCreateInviteLink(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var payload models.CreateInviteLinkPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	var link models.InviteLink
+	query := "INSERT INTO event_invite_links (event_id, expires_at, max_uses, created_by) VALUES ($1, $2, $3, $4) RETURNING " + inviteLinkColumns
+	if err := db.Get(&link, query, eventID, payload.ExpiresAt, payload.MaxUses, userID); err != nil {
+		log.Printf("Error creating invite link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite link"})
+		return
+	}
+	link.Code = invites.Code(invites.Invite{ID: link.ID, EventID: link.EventID, Nonce: link.Nonce})
+
+	c.JSON(http.StatusCreated, link)
+}
+
+func HandleListInviteLinks(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	links := []models.InviteLink{}
+	query := "SELECT " + inviteLinkColumns + " FROM event_invite_links WHERE event_id = $1 ORDER BY id"
+	if err := db.Select(&links, query, eventID); err != nil {
+		log.Printf("Error fetching invite links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invite links"})
+		return
+	}
+	for i := range links {
+		links[i].Code = invites.Code(invites.Invite{ID: links[i].ID, EventID: links[i].EventID, Nonce: links[i].Nonce})
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// HandleRevokeInviteLink stops a link from admitting anyone else. Those who
+// registered with it keep their registrations.
+func HandleRevokeInviteLink(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	linkID, ok := idParam(c, "link_id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var link models.InviteLink
+	query := `UPDATE event_invite_links SET revoked_at = COALESCE(revoked_at, now())
+		WHERE id = $1 AND event_id = $2
+		RETURNING ` + inviteLinkColumns
+	if err := db.Get(&link, query, linkID, eventID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite link not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error revoking invite link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite link revoked", "invite_link": link})
+}
+
+// HandleCreateInvites invites people to an event by email. Each address is
+// mailed its own invite code, since nothing proves that an account with
+// the address belongs to whoever reads its mail; emails invited before are
+// skipped.
+func HandleCreateInvites(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var payload models.CreateInvitesPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	created := []models.Invite{}
+	for _, email := range payload.Emails {
+		var invite models.Invite
+		query := `INSERT INTO event_invites (event_id, email, invited_by) VALUES ($1, $2, $3)
+			ON CONFLICT (event_id, email) DO NOTHING
+			RETURNING ` + inviteColumns
+		if err := tx.Get(&invite, query, eventID, email, userID); err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			log.Printf("Error creating invite: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invites"})
+			return
+		}
+		created = append(created, invite)
+
+		if _, err := jobs.Enqueue(c.Request.Context(), tx, jobSendInvite, sendInviteJob{InviteID: invite.ID}); err != nil {
+			log.Printf("Error scheduling invite email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invites"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func HandleListInvites(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	invitations := []models.Invite{}
+	query := "SELECT " + inviteColumns + " FROM event_invites WHERE event_id = $1 ORDER BY id"
+	if err := db.Select(&invitations, query, eventID); err != nil {
+		log.Printf("Error fetching invites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invites"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// HandleDeleteInvite withdraws an email invite. A registration the invitee
+// already made is kept.
+func HandleDeleteInvite(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	inviteID, ok := idParam(c, "invite_id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM event_invites WHERE id = $1 AND event_id = $2", inviteID, eventID)
+	if err != nil {
+		log.Printf("Error deleting invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invite"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite deleted"})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"database/sql"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func loadNotificationPreferences(db *sqlx.DB, userID int) (models.NotificationPreferences, error) {
+	prefs := models.NotificationPreferences{UserID: userID, EventReminders: true, EmailEnabled: true}
+	query := "SELECT user_id, event_reminders, email_enabled FROM notification_preferences WHERE user_id = $1"
+	err := db.Get(&prefs, query, userID)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return prefs, err
+}
+
+func HandleGetNotificationPreferences(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	prefs, err := loadNotificationPreferences(db, userID)
+	if err != nil {
+		log.Printf("Error fetching notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+func HandleUpdateNotificationPreferences(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	var payload models.UpdateNotificationPreferencesPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	prefs, err := loadNotificationPreferences(db, userID)
+	if err != nil {
+		log.Printf("Error fetching notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+	if payload.EventReminders != nil {
+		prefs.EventReminders = *payload.EventReminders
+	}
+	if payload.EmailEnabled != nil {
+		prefs.EmailEnabled = *payload.EmailEnabled
+	}
+
+	query := `INSERT INTO notification_preferences (user_id, event_reminders, email_enabled)
+		VALUES (:user_id, :event_reminders, :email_enabled)
+		ON CONFLICT (user_id) DO UPDATE SET event_reminders = EXCLUDED.event_reminders, email_enabled = EXCLUDED.email_enabled, updated_at = now()`
+	if _, err := db.NamedExec(query, prefs); err != nil {
+		log.Printf("Error saving notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+func HandleListNotifications(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+		return
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications := []models.Notification{}
+	query := `SELECT * FROM notifications WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY id DESC LIMIT $3`
+	if err := db.Select(&notifications, query, userID, unreadOnly, limit); err != nil {
+		log.Printf("Error fetching notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	var unread int
+	query = "SELECT count(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL"
+	if err := db.Get(&unread, query, userID); err != nil {
+		log.Printf("Error counting notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "unread_count": unread})
+}
+
+func HandleMarkNotificationRead(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	notificationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query := "UPDATE notifications SET read_at = COALESCE(read_at, now()) WHERE id = $1 AND user_id = $2"
+	result, err := db.Exec(query, notificationID, userID)
+	if err != nil {
+		log.Printf("Error marking notification read: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification read"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked read"})
+}
+
+func HandleMarkAllNotificationsRead(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	query := "UPDATE notifications SET read_at = now() WHERE user_id = $1 AND read_at IS NULL"
+	result, err := db.Exec(query, userID)
+	if err != nil {
+		log.Printf("Error marking notifications read: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+	marked, _ := result.RowsAffected()
+
+	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked read", "marked": marked})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// organizerRank orders the roles; each grants everything the ones ranked
+// below it do.
+var organizerRank = map[string]int{
+	models.OrganizerCheckIn: 1,
+	models.OrganizerEditor:  2,
+	models.OrganizerOwner:   3,
+}
+
+// requireEventOrganizer loads an event the user organizes with at least
+// role. Events they do not organize are reported as missing. On failure it
+// writes the error response and returns false.
+func requireEventOrganizer(c *gin.Context, db sqlx.Queryer, eventID, userID int, role string) (models.Event, bool) {
+	return loadOrganizedEvent(c, db, "SELECT "+eventColumns+" FROM events WHERE id = $1", eventID, userID, role)
+}
+
+// lockEventAsOrganizer is requireEventOrganizer taking the event row lock.
+func lockEventAsOrganizer(c *gin.Context, tx *sqlx.Tx, eventID, userID int, role string) (models.Event, bool) {
+	return loadOrganizedEvent(c, tx, "SELECT "+eventColumns+" FROM events WHERE id = $1 FOR UPDATE", eventID, userID, role)
+}
+
+func loadOrganizedEvent(c *gin.Context, db sqlx.Queryer, query string, eventID, userID int, role string) (models.Event, bool) {
+	var event models.Event
+	var held string
+	err := sqlx.Get(db, &event, query, eventID)
+	if err == nil {
+		err = sqlx.Get(db, &held, "SELECT role FROM event_organizers WHERE event_id = $1 AND user_id = $2", eventID, userID)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return event, false
+	} else if err != nil {
+		log.Printf("Error fetching event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return event, false
+	}
+	if organizerRank[held] < organizerRank[role] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your role on this event does not allow this", "role": held, "required_role": role})
+		return event, false
+	}
+	return event, true
+}
+
+// isEventOrganizer reports whether the user holds any role on the event.
+func isEventOrganizer(ctx context.Context, db sqlx.QueryerContext, eventID, userID int) (bool, error) {
+	var organizer bool
+	query := "SELECT EXISTS (SELECT 1 FROM event_organizers WHERE event_id = $1 AND user_id = $2)"
+	err := sqlx.GetContext(ctx, db, &organizer, query, eventID, userID)
+	return organizer, err
+}
+
+// HandleListOrganizers shows the organizers of an event to each of them.
+func HandleListOrganizers(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerCheckIn); !ok {
+		return
+	}
+
+	organizers := []models.Organizer{}
+	query := `SELECT o.event_id, o.user_id, u.username, u.email, o.role, o.added_by, o.created_at
+		FROM event_organizers o JOIN users u ON u.id = o.user_id
+		WHERE o.event_id = $1
+		ORDER BY o.created_at, o.user_id`
+	if err := db.Select(&organizers, query, eventID); err != nil {
+		log.Printf("Error fetching organizers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organizers)
+}
+
+// HandleAddOrganizer gives a user a role on the event, or changes the role
+// they have. Only owners may do so.
+func HandleAddOrganizer(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var payload models.AddOrganizerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	event, ok := requireEventOrganizer(c, tx, eventID, userID, models.OrganizerOwner)
+	if !ok {
+		return
+	}
+
+	organizer := models.Organizer{EventID: eventID, Role: payload.Role}
+	user := strings.TrimSpace(payload.User)
+	query := "SELECT id AS user_id, username, email FROM users WHERE username = $1"
+	if strings.Contains(user, "@") {
+		query = "SELECT id AS user_id, username, email FROM users WHERE email = $1"
+	}
+	if err := tx.Get(&organizer, query, user); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add organizer"})
+		return
+	}
+	if organizer.UserID == event.CreatedBy {
+		c.JSON(http.StatusConflict, gin.H{"error": "The creator of an event is always one of its owners"})
+		return
+	}
+
+	query = `INSERT INTO event_organizers (event_id, user_id, role, added_by) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (event_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING added_by, created_at`
+	if err := tx.QueryRowx(query, eventID, organizer.UserID, organizer.Role, userID).Scan(&organizer.AddedBy, &organizer.CreatedAt); err != nil {
+		log.Printf("Error adding organizer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add organizer"})
+		return
+	}
+
+	if err := notifications.Notify(c.Request.Context(), tx, organizer.UserID, notifications.KindOrganizerAdded,
+		"You are now "+organizer.Role+" of "+event.Name, "You can help manage this event.", event.ID); err != nil {
+		log.Printf("Error notifying organizer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add organizer"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, organizer)
+}
+
+// HandleRemoveOrganizer takes a user's role on the event away. Owners may
+// remove anyone but the event's creator; any organizer may step down.
+func HandleRemoveOrganizer(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	organizerID, ok := idParam(c, "user_id")
+	if !ok {
+		return
+	}
+
+	role := models.OrganizerOwner
+	if organizerID == userID {
+		role = models.OrganizerCheckIn
+	}
+	event, ok := requireEventOrganizer(c, db, eventID, userID, role)
+	if !ok {
+		return
+	}
+	if organizerID == event.CreatedBy {
+		c.JSON(http.StatusConflict, gin.H{"error": "The creator of an event cannot be removed"})
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM event_organizers WHERE event_id = $1 AND user_id = $2", eventID, organizerID)
+	if err != nil {
+		log.Printf("Error removing organizer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove organizer"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organizer not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Organizer removed"})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOrganizerRank(t *testing.T) {
+	roles := []string{models.OrganizerCheckIn, models.OrganizerEditor, models.OrganizerOwner}
+	for i := 1; i < len(roles); i++ {
+		if organizerRank[roles[i-1]] >= organizerRank[roles[i]] {
+			t.Errorf("%s ranks at or above %s", roles[i-1], roles[i])
+		}
+	}
+	// Users without a role, or with one this version does not know, are
+	// granted nothing.
+	for _, role := range []string{"", "admin"} {
+		if organizerRank[role] >= organizerRank[models.OrganizerCheckIn] {
+			t.Errorf("role %q ranks at or above checkin", role)
+		}
+	}
+}
+
+func TestWeakestRole(t *testing.T) {
+	tests := []struct {
+		held []string
+		want string
+		ok   bool
+	}{
+		{nil, "", false},
+		{[]string{models.OrganizerOwner}, models.OrganizerOwner, true},
+		{[]string{models.OrganizerOwner, models.OrganizerCheckIn, models.OrganizerEditor}, models.OrganizerCheckIn, true},
+		// An occurrence the user does not organize outranks nothing.
+		{[]string{models.OrganizerOwner, ""}, "", true},
+	}
+	for _, tt := range tests {
+		if got, ok := weakestRole(tt.held); got != tt.want || ok != tt.ok {
+			t.Errorf("weakestRole(%q) = %q, %v; want %q, %v", tt.held, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOrganizerRolesLimitWhatOrganizersMayDo(t *testing.T) {
+	db := testDB(t)
+	owner := createUser(t, db, "owner")
+	editor := createUser(t, db, "editor")
+	createUser(t, db, "door")
+	createUser(t, db, "mallory")
+	event := createEvent(t, db, owner, intPtr(10))
+	path := "/events/" + strconv.Itoa(event.ID)
+
+	add := func(c *gin.Context) { HandleAddOrganizer(c, db) }
+	expectStatus(t, perform(t, add, "editor", http.MethodPost, "/events/:id/organizers", path+"/organizers", gin.H{"user": "door", "role": models.OrganizerCheckIn}), http.StatusNotFound)
+	expectStatus(t, perform(t, add, "owner", http.MethodPost, "/events/:id/organizers", path+"/organizers", gin.H{"user": "editor", "role": models.OrganizerEditor}), http.StatusCreated)
+	expectStatus(t, perform(t, add, "owner", http.MethodPost, "/events/:id/organizers", path+"/organizers", gin.H{"user": "door@example.com", "role": models.OrganizerCheckIn}), http.StatusCreated)
+	expectStatus(t, perform(t, add, "editor", http.MethodPost, "/events/:id/organizers", path+"/organizers", gin.H{"user": "mallory", "role": models.OrganizerOwner}), http.StatusForbidden)
+
+	setPolicy := func(c *gin.Context) { HandleSetRefundPolicy(c, db) }
+	policy := gin.H{"full_refund_days": 7, "partial_refund_days": 1, "partial_refund_percent": 50}
+	export := func(c *gin.Context) { HandleExportRegistrations(c, db) }
+	attendance := func(c *gin.Context) { HandleAttendanceReport(c, db) }
+	cancel := func(c *gin.Context) { HandleCancelEvent(c, db, broker.NewLocal()) }
+
+	// Check-in staff see attendance, and nothing an editor manages.
+	expectStatus(t, perform(t, attendance, "door", http.MethodGet, "/events/:id/attendance", path+"/attendance", nil), http.StatusOK)
+	expectStatus(t, perform(t, setPolicy, "door", http.MethodPut, "/events/:id/refund-policy", path+"/refund-policy", policy), http.StatusForbidden)
+	expectStatus(t, perform(t, export, "door", http.MethodGet, "/events/:id/registrations/export", path+"/registrations/export", nil), http.StatusForbidden)
+
+	// Editors manage the event but may not cancel it.
+	expectStatus(t, perform(t, setPolicy, "editor", http.MethodPut, "/events/:id/refund-policy", path+"/refund-policy", policy), http.StatusOK)
+	expectStatus(t, perform(t, export, "editor", http.MethodGet, "/events/:id/registrations/export", path+"/registrations/export", nil), http.StatusOK)
+	expectStatus(t, perform(t, cancel, "editor", http.MethodPost, "/events/:id/cancel", path+"/cancel", nil), http.StatusForbidden)
+
+	// Everyone else is told the event does not exist.
+	expectStatus(t, perform(t, attendance, "mallory", http.MethodGet, "/events/:id/attendance", path+"/attendance", nil), http.StatusNotFound)
+	expectStatus(t, perform(t, setPolicy, "mallory", http.MethodPut, "/events/:id/refund-policy", path+"/refund-policy", policy), http.StatusNotFound)
+
+	remove := func(c *gin.Context) { HandleRemoveOrganizer(c, db) }
+	creator := path + "/organizers/" + strconv.Itoa(owner)
+	expectStatus(t, perform(t, remove, "owner", http.MethodDelete, "/events/:id/organizers/:user_id", creator, nil), http.StatusConflict)
+	expectStatus(t, perform(t, remove, "editor", http.MethodDelete, "/events/:id/organizers/:user_id", creator, nil), http.StatusForbidden)
+	self := path + "/organizers/" + strconv.Itoa(editor)
+	expectStatus(t, perform(t, remove, "editor", http.MethodDelete, "/events/:id/organizers/:user_id", self, nil), http.StatusOK)
+	expectStatus(t, perform(t, setPolicy, "editor", http.MethodPut, "/events/:id/refund-policy", path+"/refund-policy", policy), http.StatusNotFound)
+
+	expectStatus(t, perform(t, cancel, "owner", http.MethodPost, "/events/:id/cancel", path+"/cancel", nil), http.StatusOK)
+}
+
+func TestEventManagersHearAboutRegistrations(t *testing.T) {
+	db := testDB(t)
+	owner := createUser(t, db, "owner")
+	editor := createUser(t, db, "editor")
+	door := createUser(t, db, "door")
+	createUser(t, db, "alice")
+	event := createEvent(t, db, owner, intPtr(10))
+	path := "/events/" + strconv.Itoa(event.ID)
+
+	add := func(c *gin.Context) { HandleAddOrganizer(c, db) }
+	expectStatus(t, perform(t, add, "owner", http.MethodPost, "/events/:id/organizers", path+"/organizers", gin.H{"user": "editor", "role": models.OrganizerEditor}), http.StatusCreated)
+	expectStatus(t, perform(t, add, "owner", http.MethodPost, "/events/:id/organizers", path+"/organizers", gin.H{"user": "door", "role": models.OrganizerCheckIn}), http.StatusCreated)
+
+	registerFor(t, db, broker.NewLocal(), "alice", event.ID)
+
+	// Everyone managing the event hears of it; check-in staff do not.
+	query := "SELECT count(*) FROM notifications WHERE user_id = $1 AND kind = $2"
+	for userID, want := range map[int]int{owner: 1, editor: 1, door: 0} {
+		if n := countRows(t, db, query, userID, notifications.KindNewRegistration); n != want {
+			t.Errorf("user %d has %d registration notifications, want %d", userID, n, want)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"homework/app/internal/broker"
+	"homework/app/internal/jobs"
+	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"homework/app/internal/payments"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	jobExpireHold = "registration.expire_hold"
+	jobRefund     = "payment.refund"
+
+	maxPaymentWebhookSize = 1 << 20
+)
+
+const registrationPaymentColumns = "id, event_id, participant_id, registration_date, status, cancelled_at, ticket_type_id, quantity, amount, currency, payment_provider, checkout_id, checkout_url, payment_id, hold_expires_at, paid_at, promo_code_id, discount, refund_amount, refund_id, refunded_at, reviewed_at, reviewed_by, review_reason"
+
+type expireHoldJob struct {
+	RegistrationID int `json:"registration_id"`
+}
+
+type refundJob struct {
+	RegistrationID int    `json:"registration_id"`
+	EventID        int    `json:"event_id"`
+	PaymentID      string `json:"payment_id"`
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency"`
+	// Note explains the refund in the ledger.
+	Note string `json:"note"`
+}
+
+// RegisterPaymentJobs installs the handlers that expire unpaid holds and
+// issue refunds.
+func RegisterPaymentJobs(runner *jobs.Runner, db *sqlx.DB, hub broker.Broker, provider payments.PaymentProvider) {
+	runner.Register(jobExpireHold, func(ctx context.Context, job jobs.Job) error {
+		var p expireHoldJob
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return err
+		}
+		return expireHold(ctx, db, hub, p.RegistrationID)
+	})
+	runner.Register(jobRefund, func(ctx context.Context, job jobs.Job) error {
+		var p refundJob
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return err
+		}
+		return issueRefund(ctx, db, provider, p)
+	})
+}
+
+// scheduleRefund records the refund a registration is owed and enqueues the
+// job that issues it.
+func scheduleRefund(ctx context.Context, tx *sqlx.Tx, refund refundJob) error {
+	query := "UPDATE registrations SET refund_amount = $1 WHERE id = $2"
+	if _, err := tx.ExecContext(ctx, query, refund.Amount, refund.RegistrationID); err != nil {
+		return err
+	}
+	_, err := jobs.Enqueue(ctx, tx, jobRefund, refund)
+	return err
+}
+
+// issueRefund pays a scheduled refund back through the provider and records
+// it on the registration and in the ledger. A registration already marked
+// refunded is skipped. A registration is refunded at most once, so its id
+// keys the refund at the provider: a job retried after the provider paid
+// but recording it failed gets the same refund back instead of a second.
+func issueRefund(ctx context.Context, db *sqlx.DB, provider payments.PaymentProvider, p refundJob) error {
+	var refundedAt *time.Time
+	query := "SELECT refunded_at FROM registrations WHERE id = $1"
+	if err := db.GetContext(ctx, &refundedAt, query, p.RegistrationID); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if refundedAt != nil {
+		return nil
+	}
+
+	refund, err := provider.Refund(ctx, payments.RefundRequest{
+		PaymentID:      p.PaymentID,
+		Amount:         p.Amount,
+		Currency:       p.Currency,
+		IdempotencyKey: refundIdempotencyKey(p.RegistrationID),
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query = "UPDATE registrations SET refund_id = $1, refunded_at = now() WHERE id = $2"
+	if _, err := tx.ExecContext(ctx, query, refund.ID, p.RegistrationID); err != nil {
+		return err
+	}
+	if err := recordLedgerEntry(ctx, tx, models.LedgerEntry{
+		RegistrationID: p.RegistrationID,
+		EventID:        p.EventID,
+		Kind:           models.LedgerRefund,
+		Amount:         refund.Amount,
+		Currency:       p.Currency,
+		Provider:       provider.Name(),
+		Reference:      refund.ID,
+		Note:           p.Note,
+	}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Refunded %d %s for registration %d (refund %s)", refund.Amount, p.Currency, p.RegistrationID, refund.ID)
+	return nil
+}
+
+func refundIdempotencyKey(registrationID int) string {
+	return "registration-" + strconv.Itoa(registrationID) + "-refund"
+}
+
+// scheduleHoldExpiry enqueues the job that releases the seats of a held
+// registration if it is still unpaid at its deadline.
+func scheduleHoldExpiry(ctx context.Context, tx *sqlx.Tx, registration models.Registration) error {
+	_, err := jobs.Enqueue(ctx, tx, jobExpireHold, expireHoldJob{RegistrationID: registration.ID}, jobs.RunAt(*registration.HoldExpiresAt))
+	return err
+}
+
+// startCheckout opens a checkout for a held registration and records it.
+func startCheckout(ctx context.Context, db *sqlx.DB, provider payments.PaymentProvider, registration *models.Registration, description string) error {
+	checkout, err := provider.CreateCheckout(ctx, payments.CheckoutRequest{
+		Reference:   strconv.Itoa(registration.ID),
+		Amount:      registration.Amount,
+		Currency:    registration.Currency,
+		Description: description,
+		ExpiresAt:   *registration.HoldExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE registrations SET payment_provider = $1, checkout_id = $2, checkout_url = $3
+		WHERE id = $4 AND status = 'pending_payment'`
+	if _, err := db.ExecContext(ctx, query, provider.Name(), checkout.ID, checkout.URL, registration.ID); err != nil {
+		return err
+	}
+	registration.CheckoutURL = &checkout.URL
+	return nil
+}
+
+// HandleCreateCheckout returns the checkout of the caller's held
+// registration, opening one if none exists yet.
+func HandleCreateCheckout(c *gin.Context, db *sqlx.DB, provider payments.PaymentProvider) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var registration models.Registration
+	query := "SELECT " + registrationPaymentColumns + " FROM registrations WHERE id = $1"
+	err := db.Get(&registration, query, registrationID)
+	if err == sql.ErrNoRows || (err == nil && registration.ParticipantID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch registration"})
+		return
+	}
+	if registration.Status != models.RegistrationPendingPayment || !time.Now().Before(*registration.HoldExpiresAt) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration is not awaiting payment", "status": registration.Status})
+		return
+	}
+
+	if registration.CheckoutURL == nil {
+		var eventName string
+		if err := db.Get(&eventName, "SELECT name FROM events WHERE id = $1", registration.EventID); err != nil {
+			log.Printf("Error fetching event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start checkout"})
+			return
+		}
+		if err := startCheckout(c.Request.Context(), db, provider, &registration, eventName); err != nil {
+			log.Printf("Error starting checkout: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to start checkout"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"registration_id": registration.ID,
+		"checkout_url":    registration.CheckoutURL,
+		"amount":          registration.Amount,
+		"currency":        registration.Currency,
+		"hold_expires_at": registration.HoldExpiresAt,
+	})
+}
+
+// HandlePaymentWebhook receives checkout outcomes from the payment provider.
+// Anything but a 2xx makes the provider retry, so only failures worth
+// retrying are reported as errors.
+func HandlePaymentWebhook(c *gin.Context, db *sqlx.DB, hub broker.Broker, provider payments.PaymentProvider) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPaymentWebhookSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	event, err := provider.VerifyWebhook(c.Request.Header, body)
+	if err != nil {
+		log.Printf("Rejected payment webhook: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook"})
+		return
+	}
+
+	if err := processPaymentEvent(c.Request.Context(), db, hub, event); err != nil {
+		log.Printf("Error processing payment webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// HandleFakeCheckoutComplete pays a checkout of the fake provider and feeds
+// the signed webhook it produces through the regular webhook path.
+func HandleFakeCheckoutComplete(c *gin.Context, db *sqlx.DB, hub broker.Broker, fake *payments.Fake) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	checkoutID := c.Param("checkout_id")
+
+	// Only the participant the checkout was created for may pay it.
+	var participantID int
+	err := db.Get(&participantID, "SELECT participant_id FROM registrations WHERE checkout_id = $1", checkoutID)
+	if err == sql.ErrNoRows || (err == nil && participantID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checkout not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete checkout"})
+		return
+	}
+
+	header, body, err := fake.Complete(checkoutID)
+	if errors.Is(err, payments.ErrUnknownCheckout) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checkout not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error completing fake checkout: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete checkout"})
+		return
+	}
+
+	event, err := fake.VerifyWebhook(header, body)
+	if err != nil {
+		log.Printf("Error verifying fake webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete checkout"})
+		return
+	}
+	if err := processPaymentEvent(c.Request.Context(), db, hub, event); err != nil {
+		log.Printf("Error processing payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete checkout"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Checkout completed"})
+}
+
+// processPaymentEvent applies a verified webhook to the registration its
+// checkout belongs to. Webhooks may be delivered more than once, so applying
+// one again changes nothing.
+func processPaymentEvent(ctx context.Context, db *sqlx.DB, hub broker.Broker, event payments.WebhookEvent) error {
+	var eventID int
+	query := "SELECT event_id FROM registrations WHERE checkout_id = $1"
+	if err := db.GetContext(ctx, &eventID, query, event.CheckoutID); err == sql.ErrNoRows {
+		log.Printf("Ignoring payment webhook for unknown checkout %s", event.CheckoutID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case payments.EventCheckoutCompleted:
+		return completePayment(ctx, db, hub, eventID, event)
+	case payments.EventCheckoutExpired:
+		// The hold itself still runs until its deadline; the participant may
+		// open a new checkout until then.
+		query = "UPDATE registrations SET checkout_id = NULL, checkout_url = NULL WHERE checkout_id = $1 AND status = 'pending_payment'"
+		_, err := db.ExecContext(ctx, query, event.CheckoutID)
+		return err
+	default:
+		log.Printf("Ignoring payment webhook of type %s", event.Type)
+		return nil
+	}
+}
+
+// completePayment confirms the held registration a checkout paid for. A
+// payment for a hold that already expired or was cancelled is refunded.
+func completePayment(ctx context.Context, db *sqlx.DB, hub broker.Broker, eventID int, payment payments.WebhookEvent) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var event models.Event
+	query := "SELECT id, name, created_by, participant_count, capacity, status FROM events WHERE id = $1 FOR UPDATE"
+	if err := tx.GetContext(ctx, &event, query, eventID); err != nil {
+		return err
+	}
+
+	var registration models.Registration
+	query = "SELECT " + registrationPaymentColumns + " FROM registrations WHERE checkout_id = $1 FOR UPDATE"
+	if err := tx.GetContext(ctx, &registration, query, payment.CheckoutID); err != nil {
+		return err
+	}
+	if registration.PaymentID != nil {
+		return nil
+	}
+
+	provider := ""
+	if registration.PaymentProvider != nil {
+		provider = *registration.PaymentProvider
+	}
+	if err := recordLedgerEntry(ctx, tx, models.LedgerEntry{
+		RegistrationID: registration.ID,
+		EventID:        eventID,
+		Kind:           models.LedgerPayment,
+		Amount:         payment.Amount,
+		Currency:       payment.Currency,
+		Provider:       provider,
+		Reference:      payment.PaymentID,
+	}); err != nil {
+		return err
+	}
+
+	// A payment that cannot confirm the registration is paid back; one for
+	// the wrong amount leaves the hold to expire.
+	if note := refusePayment(event, registration, payment); note != "" {
+		log.Printf("Refunding payment %s for registration %d: %s", payment.PaymentID, registration.ID, note)
+		query = "UPDATE registrations SET payment_id = $1 WHERE id = $2"
+		if _, err := tx.ExecContext(ctx, query, payment.PaymentID, registration.ID); err != nil {
+			return err
+		}
+		if err := scheduleRefund(ctx, tx, refundJob{
+			RegistrationID: registration.ID,
+			EventID:        eventID,
+			PaymentID:      payment.PaymentID,
+			Amount:         payment.Amount,
+			Currency:       payment.Currency,
+			Note:           note,
+		}); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	query = `UPDATE registrations SET status = 'confirmed', payment_id = $1, paid_at = now(), hold_expires_at = NULL
+		WHERE id = $2
+		RETURNING ` + registrationPaymentColumns
+	if err := tx.GetContext(ctx, &registration, query, payment.PaymentID, registration.ID); err != nil {
+		return err
+	}
+	if err := announceRegistration(ctx, tx, event, registration); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	publishEventState(ctx, db, hub, eventID)
+	return nil
+}
+
+// refusePayment explains why payment cannot confirm registration, for the
+// ledger note of its refund, or returns "" if it can.
+func refusePayment(event models.Event, registration models.Registration, payment payments.WebhookEvent) string {
+	switch {
+	case registration.Status != models.RegistrationPendingPayment:
+		return "Paid after the registration was " + registration.Status + ", full refund"
+	case event.Status == models.EventCancelled:
+		return "Paid after the event was cancelled, full refund"
+	case payment.Amount != registration.Amount || payment.Currency != registration.Currency:
+		return fmt.Sprintf("Paid %d %s instead of %d %s, full refund", payment.Amount, payment.Currency, registration.Amount, registration.Currency)
+	}
+	return ""
+}
+
+// expireHold releases the seats of a registration still unpaid at its
+// deadline and offers them to the waitlist.
+func expireHold(ctx context.Context, db *sqlx.DB, hub broker.Broker, registrationID int) error {
+	var eventID int
+	query := "SELECT event_id FROM registrations WHERE id = $1"
+	if err := db.GetContext(ctx, &eventID, query, registrationID); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var eventName string
+	query = "SELECT name FROM events WHERE id = $1 FOR UPDATE"
+	if err := tx.GetContext(ctx, &eventName, query, eventID); err != nil {
+		return err
+	}
+
+	var registration models.Registration
+	query = `UPDATE registrations SET status = 'expired'
+		WHERE id = $1 AND status = 'pending_payment' AND hold_expires_at <= now()
+		RETURNING ` + registrationPaymentColumns
+	err = tx.GetContext(ctx, &registration, query, registrationID)
+	if err == sql.ErrNoRows {
+		// Paid, cancelled or not due yet.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := releaseSeats(ctx, tx, registration); err != nil {
+		return err
+	}
+	if err := notifications.Notify(ctx, tx, registration.ParticipantID, notifications.KindHoldExpired,
+		"Your seat at "+eventName+" was released", "The checkout was not completed in time.", eventID); err != nil {
+		return err
+	}
+	if err := promoteWaitlisted(ctx, tx, eventID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	publishEventState(ctx, db, hub, eventID)
+	return nil
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"homework/app/internal/payments"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRefusePayment(t *testing.T) {
+	published := models.Event{Status: models.EventPublished}
+	held := models.Registration{Status: models.RegistrationPendingPayment, Amount: 2500, Currency: "EUR"}
+	paid := payments.WebhookEvent{Amount: 2500, Currency: "EUR"}
+
+	tests := []struct {
+		name         string
+		event        models.Event
+		registration models.Registration
+		payment      payments.WebhookEvent
+		refused      bool
+	}{
+		{"matching payment", published, held, paid, false},
+		{"too little", published, held, payments.WebhookEvent{Amount: 100, Currency: "EUR"}, true},
+		{"too much", published, held, payments.WebhookEvent{Amount: 5000, Currency: "EUR"}, true},
+		{"other currency", published, held, payments.WebhookEvent{Amount: 2500, Currency: "USD"}, true},
+		{"expired hold", published, models.Registration{Status: models.RegistrationExpired, Amount: 2500, Currency: "EUR"}, paid, true},
+		{"cancelled event", models.Event{Status: models.EventCancelled}, held, paid, true},
+	}
+	for _, tt := range tests {
+		if note := refusePayment(tt.event, tt.registration, tt.payment); (note != "") != tt.refused {
+			t.Errorf("%s: refusePayment = %q, want refused = %v", tt.name, note, tt.refused)
+		}
+	}
+}
+
+// holdSeat stores a registration of participantID awaiting payment of
+// 2500 EUR through checkout "cs_test".
+func holdSeat(t *testing.T, db *sqlx.DB, eventID, participantID int) models.Registration {
+	t.Helper()
+	registration := models.Registration{
+		EventID:          eventID,
+		ParticipantID:    participantID,
+		RegistrationDate: time.Now(),
+		Status:           models.RegistrationPendingPayment,
+		Quantity:         1,
+		Amount:           2500,
+		Currency:         "EUR",
+	}
+	deadline := time.Now().Add(time.Hour)
+	registration.HoldExpiresAt = &deadline
+	query := `INSERT INTO registrations (event_id, participant_id, registration_date, status, quantity, amount, currency, hold_expires_at, payment_provider, checkout_id)
+		VALUES (:event_id, :participant_id, :registration_date, :status, :quantity, :amount, :currency, :hold_expires_at, 'fake', 'cs_test')
+		RETURNING id`
+	query, args, err := db.BindNamed(query, registration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&registration.ID, query, args...); err != nil {
+		t.Fatalf("hold seat: %v", err)
+	}
+	if _, err := db.Exec("UPDATE events SET participant_count = participant_count + 1 WHERE id = $1", eventID); err != nil {
+		t.Fatal(err)
+	}
+	return registration
+}
+
+func loadRegistration(t *testing.T, db *sqlx.DB, id int) models.Registration {
+	t.Helper()
+	var registration models.Registration
+	if err := db.Get(&registration, "SELECT "+registrationPaymentColumns+" FROM registrations WHERE id = $1", id); err != nil {
+		t.Fatal(err)
+	}
+	return registration
+}
+
+func countRows(t *testing.T, db *sqlx.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.Get(&n, query, args...); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCompletedPaymentConfirmsRegistration(t *testing.T) {
+	db := testDB(t)
+	owner := createUser(t, db, "owner")
+	alice := createUser(t, db, "alice")
+	event := createEvent(t, db, owner, intPtr(10))
+	held := holdSeat(t, db, event.ID, alice)
+
+	payment := payments.WebhookEvent{Type: payments.EventCheckoutCompleted, CheckoutID: "cs_test", PaymentID: "pi_1", Amount: 2500, Currency: "EUR"}
+	for range 2 {
+		// Providers may deliver a webhook more than once.
+		if err := processPaymentEvent(context.Background(), db, broker.NewLocal(), payment); err != nil {
+			t.Fatalf("process payment: %v", err)
+		}
+	}
+
+	registration := loadRegistration(t, db, held.ID)
+	if registration.Status != models.RegistrationConfirmed || registration.PaidAt == nil || registration.HoldExpiresAt != nil {
+		t.Fatalf("registration = %s, paid at %v, hold until %v; want confirmed and paid", registration.Status, registration.PaidAt, registration.HoldExpiresAt)
+	}
+	if registration.PaymentID == nil || *registration.PaymentID != "pi_1" {
+		t.Errorf("payment_id = %v, want pi_1", registration.PaymentID)
+	}
+	if n := countRows(t, db, "SELECT count(*) FROM payment_ledger WHERE registration_id = $1 AND kind = 'payment' AND amount = 2500", held.ID); n != 1 {
+		t.Errorf("%d payment ledger entries, want 1", n)
+	}
+	if n := countRows(t, db, "SELECT count(*) FROM jobs WHERE kind = $1", jobRefund); n != 0 {
+		t.Errorf("%d refunds scheduled, want none", n)
+	}
+}
+
+func TestPaymentOfWrongAmountIsRefunded(t *testing.T) {
+	db := testDB(t)
+	owner := createUser(t, db, "owner")
+	alice := createUser(t, db, "alice")
+	event := createEvent(t, db, owner, intPtr(10))
+	held := holdSeat(t, db, event.ID, alice)
+
+	payment := payments.WebhookEvent{Type: payments.EventCheckoutCompleted, CheckoutID: "cs_test", PaymentID: "pi_1", Amount: 100, Currency: "EUR"}
+	if err := processPaymentEvent(context.Background(), db, broker.NewLocal(), payment); err != nil {
+		t.Fatalf("process payment: %v", err)
+	}
+
+	registration := loadRegistration(t, db, held.ID)
+	if registration.Status != models.RegistrationPendingPayment || registration.PaidAt != nil {
+		t.Fatalf("registration = %s, paid at %v; want still awaiting payment", registration.Status, registration.PaidAt)
+	}
+	if registration.RefundAmount != 100 {
+		t.Errorf("refund_amount = %d, want the 100 paid", registration.RefundAmount)
+	}
+	if n := countRows(t, db, "SELECT count(*) FROM jobs WHERE kind = $1", jobRefund); n != 1 {
+		t.Errorf("%d refunds scheduled, want 1", n)
+	}
+
+	// Cancelling afterwards must not refund the payment a second time.
+	expectStatus(t, cancelFor(t, db, broker.NewLocal(), "alice", event.ID), http.StatusOK)
+	if n := countRows(t, db, "SELECT count(*) FROM jobs WHERE kind = $1", jobRefund); n != 1 {
+		t.Errorf("%d refunds scheduled after cancelling, want 1", n)
+	}
+}
+
+func TestFakeCheckoutIsCompletedOnlyByItsParticipant(t *testing.T) {
+	db := testDB(t)
+	owner := createUser(t, db, "owner")
+	alice := createUser(t, db, "alice")
+	createUser(t, db, "mallory")
+	event := createEvent(t, db, owner, intPtr(10))
+
+	fake := payments.NewFake([]byte("test-secret"), "http://localhost")
+	checkout, err := fake.CreateCheckout(context.Background(), payments.CheckoutRequest{Amount: 2500, Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	held := holdSeat(t, db, event.ID, alice)
+	if _, err := db.Exec("UPDATE registrations SET checkout_id = $1 WHERE id = $2", checkout.ID, held.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := func(c *gin.Context) { HandleFakeCheckoutComplete(c, db, broker.NewLocal(), fake) }
+	pattern := "/payments/fake/checkouts/:checkout_id/complete"
+	path := "/payments/fake/checkouts/" + checkout.ID + "/complete"
+
+	expectStatus(t, perform(t, handler, "", http.MethodPost, pattern, path, nil), http.StatusUnauthorized)
+	expectStatus(t, perform(t, handler, "mallory", http.MethodPost, pattern, path, nil), http.StatusNotFound)
+	if status := loadRegistration(t, db, held.ID).Status; status != models.RegistrationPendingPayment {
+		t.Fatalf("registration = %s after others tried to pay it, want pending_payment", status)
+	}
+
+	expectStatus(t, perform(t, handler, "alice", http.MethodPost, pattern, path, nil), http.StatusOK)
+	if status := loadRegistration(t, db, held.ID).Status; status != models.RegistrationConfirmed {
+		t.Fatalf("registration = %s, want confirmed", status)
+	}
+}
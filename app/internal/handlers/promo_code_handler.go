@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var promoCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var (
+	errPromoCodeInvalid   = errors.New("Promo code is not valid for this order")
+	errPromoCodeUsedUp    = errors.New("Promo code has been used up")
+	errPromoCodeUserLimit = errors.New("Promo code already used the maximum number of times by this participant")
+)
+
+// promoUsesQuery counts redemptions: every registration that used the code,
+// except unpaid holds that expired and rejected applications.
+const promoUsesQuery = `SELECT count(*) FROM registrations WHERE promo_code_id = p.id AND status NOT IN ('expired', 'rejected')`
+
+func HandleCreatePromoCode(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var payload models.CreatePromoCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	switch {
+	case !promoCodePattern.MatchString(payload.Code):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code may only contain letters, digits, - and _"})
+		return
+	case payload.Kind == models.PromoPercentage && payload.Amount > 100:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A percentage discount cannot exceed 100"})
+		return
+	case payload.Kind == models.PromoFixed && payload.Currency == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A fixed discount needs a currency"})
+		return
+	case payload.ValidFrom != nil && payload.ValidUntil != nil && !payload.ValidUntil.After(*payload.ValidFrom):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "valid_until must be after valid_from"})
+		return
+	}
+
+	promo := models.PromoCode{
+		EventID:       eventID,
+		Code:          payload.Code,
+		Kind:          payload.Kind,
+		Amount:        payload.Amount,
+		MaxUses:       payload.MaxUses,
+		PerUserLimit:  payload.PerUserLimit,
+		ValidFrom:     payload.ValidFrom,
+		ValidUntil:    payload.ValidUntil,
+		TicketTypeIDs: []int{},
+	}
+	if payload.Kind == models.PromoFixed {
+		promo.Currency = payload.Currency
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO promo_codes (event_id, code, kind, amount, currency, max_uses, per_user_limit, valid_from, valid_until)
+		VALUES (:event_id, :code, :kind, :amount, :currency, :max_uses, :per_user_limit, :valid_from, :valid_until)
+		RETURNING id, created_at`
+	query, args, err := tx.BindNamed(query, promo)
+	if err != nil {
+		log.Printf("Error binding promo code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code"})
+		return
+	}
+	if err := tx.QueryRowx(query, args...).Scan(&promo.ID, &promo.CreatedAt); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			c.JSON(http.StatusConflict, gin.H{"error": "This event already has that promo code"})
+			return
+		}
+		log.Printf("Error creating promo code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code"})
+		return
+	}
+
+	slices.Sort(payload.TicketTypeIDs)
+	for _, ticketTypeID := range slices.Compact(payload.TicketTypeIDs) {
+		query = `INSERT INTO promo_code_ticket_types (promo_code_id, ticket_type_id)
+			SELECT $1, id FROM ticket_types WHERE id = $2 AND event_id = $3`
+		result, err := tx.Exec(query, promo.ID, ticketTypeID, eventID)
+		if err != nil {
+			log.Printf("Error restricting promo code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code"})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket type not found", "ticket_type_id": ticketTypeID})
+			return
+		}
+		promo.TicketTypeIDs = append(promo.TicketTypeIDs, ticketTypeID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, promo)
+}
+
+func HandleListPromoCodes(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	promos := []models.PromoCode{}
+	query := `SELECT p.id, p.event_id, p.code, p.kind, p.amount, p.currency, p.max_uses, p.per_user_limit,
+			p.valid_from, p.valid_until, p.created_at, (` + promoUsesQuery + `) AS uses
+		FROM promo_codes p WHERE p.event_id = $1 ORDER BY p.id`
+	if err := db.Select(&promos, query, eventID); err != nil {
+		log.Printf("Error fetching promo codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promo codes"})
+		return
+	}
+
+	var restrictions []struct {
+		PromoCodeID  int `db:"promo_code_id"`
+		TicketTypeID int `db:"ticket_type_id"`
+	}
+	query = `SELECT r.promo_code_id, r.ticket_type_id FROM promo_code_ticket_types r
+		JOIN promo_codes p ON p.id = r.promo_code_id
+		WHERE p.event_id = $1 ORDER BY r.ticket_type_id`
+	if err := db.Select(&restrictions, query, eventID); err != nil {
+		log.Printf("Error fetching promo code restrictions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promo codes"})
+		return
+	}
+	for i := range promos {
+		promos[i].TicketTypeIDs = []int{}
+		for _, r := range restrictions {
+			if r.PromoCodeID == promos[i].ID {
+				promos[i].TicketTypeIDs = append(promos[i].TicketTypeIDs, r.TicketTypeID)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, promos)
+}
+
+func HandleDeletePromoCode(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	promoCodeID, ok := idParam(c, "promo_code_id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	// Registrations that redeemed the code keep their discount.
+	result, err := db.Exec("DELETE FROM promo_codes WHERE id = $1 AND event_id = $2", promoCodeID, eventID)
+	if err != nil {
+		log.Printf("Error deleting promo code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete promo code"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promo code not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promo code deleted"})
+}
+
+// redeemPromoCode checks that code may discount an order of ticketType by
+// participantID and returns it with the discount it gives on subtotal. The
+// caller must hold the event row lock, which serialises redemptions so usage
+// caps cannot be exceeded.
+func redeemPromoCode(ctx context.Context, tx *sqlx.Tx, eventID, participantID int, code string, ticketType *models.TicketType, subtotal int64) (*models.PromoCode, int64, error) {
+	if ticketType == nil {
+		return nil, 0, errPromoCodeInvalid
+	}
+
+	var promo models.PromoCode
+	query := `SELECT id, event_id, code, kind, amount, currency, max_uses, per_user_limit, valid_from, valid_until, created_at
+		FROM promo_codes WHERE event_id = $1 AND code = $2`
+	if err := tx.GetContext(ctx, &promo, query, eventID, code); err == sql.ErrNoRows {
+		return nil, 0, errPromoCodeInvalid
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	if (promo.ValidFrom != nil && now.Before(*promo.ValidFrom)) || (promo.ValidUntil != nil && !now.Before(*promo.ValidUntil)) {
+		return nil, 0, errPromoCodeInvalid
+	}
+	if promo.Kind == models.PromoFixed && (promo.Currency == nil || *promo.Currency != ticketType.Currency) {
+		return nil, 0, errPromoCodeInvalid
+	}
+
+	query = "SELECT ticket_type_id FROM promo_code_ticket_types WHERE promo_code_id = $1"
+	if err := tx.SelectContext(ctx, &promo.TicketTypeIDs, query, promo.ID); err != nil {
+		return nil, 0, err
+	}
+	if len(promo.TicketTypeIDs) > 0 && !slices.Contains(promo.TicketTypeIDs, ticketType.ID) {
+		return nil, 0, errPromoCodeInvalid
+	}
+
+	var uses struct {
+		Total int `db:"total"`
+		Mine  int `db:"mine"`
+	}
+	query = `SELECT count(*) AS total, count(*) FILTER (WHERE participant_id = $2) AS mine
+		FROM registrations WHERE promo_code_id = $1 AND status NOT IN ('expired', 'rejected')`
+	if err := tx.GetContext(ctx, &uses, query, promo.ID, participantID); err != nil {
+		return nil, 0, err
+	}
+	if promo.MaxUses != nil && uses.Total >= *promo.MaxUses {
+		return nil, 0, errPromoCodeUsedUp
+	}
+	if promo.PerUserLimit != nil && uses.Mine >= *promo.PerUserLimit {
+		return nil, 0, errPromoCodeUserLimit
+	}
+	promo.Uses = uses.Total
+
+	discount := promo.Amount
+	if promo.Kind == models.PromoPercentage {
+		discount = subtotal * promo.Amount / 100
+	}
+	return &promo, min(discount, subtotal), nil
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const questionColumns = "id, event_id, label, kind, required, options, position, created_at"
+
+const maxTextAnswer = 2000
+
+// answerError reports an answer that does not fit its question.
+type answerError struct {
+	QuestionID int
+	Reason     string
+}
+
+func (e *answerError) Error() string {
+	return fmt.Sprintf("question %d: %s", e.QuestionID, e.Reason)
+}
+
+// questionFromPayload checks the settings of a question that the binding
+// tags cannot express.
+func questionFromPayload(payload models.QuestionPayload, eventID int) (models.Question, error) {
+	question := models.Question{
+		EventID:  eventID,
+		Label:    strings.TrimSpace(payload.Label),
+		Kind:     payload.Kind,
+		Required: payload.Required,
+		Options:  payload.Options,
+		Position: payload.Position,
+	}
+	if question.Options == nil {
+		question.Options = []string{}
+	}
+	if question.Label == "" {
+		return question, errors.New("label must not be blank")
+	}
+	switch question.Kind {
+	case models.QuestionSingleChoice, models.QuestionMultiChoice:
+		if len(question.Options) == 0 {
+			return question, errors.New("choice questions need options")
+		}
+		sorted := slices.Clone(question.Options)
+		slices.Sort(sorted)
+		if len(slices.Compact(sorted)) != len(question.Options) {
+			return question, errors.New("options must be unique")
+		}
+	default:
+		if len(question.Options) > 0 {
+			return question, errors.New("only choice questions take options")
+		}
+	}
+	return question, nil
+}
+
+func HandleCreateQuestion(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var payload models.QuestionPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	question, err := questionFromPayload(payload, eventID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `INSERT INTO registration_questions (event_id, label, kind, required, options, position)
+		VALUES (:event_id, :label, :kind, :required, :options, :position)
+		RETURNING id, created_at`
+	query, args, err := db.BindNamed(query, question)
+	if err != nil {
+		log.Printf("Error binding question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create question"})
+		return
+	}
+	if err := db.QueryRowx(query, args...).Scan(&question.ID, &question.CreatedAt); err != nil {
+		log.Printf("Error creating question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create question"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, question)
+}
+
+func HandleListQuestions(c *gin.Context, db *sqlx.DB) {
+	userID, ok := optionalUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventAccess(c, db, eventID, userID); !ok {
+		return
+	}
+
+	questions, err := loadQuestions(c.Request.Context(), db, eventID)
+	if err != nil {
+		log.Printf("Error fetching questions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, questions)
+}
+
+func HandleUpdateQuestion(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	questionID, ok := idParam(c, "question_id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var payload models.QuestionPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	question, err := questionFromPayload(payload, eventID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	question.ID = questionID
+
+	// Answers already given were validated against the old settings and
+	// are kept as they are.
+	var kind string
+	err = db.Get(&kind, "SELECT kind FROM registration_questions WHERE id = $1 AND event_id = $2", questionID, eventID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
+		return
+	}
+	if kind != question.Kind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The kind of a question cannot be changed"})
+		return
+	}
+
+	query := `UPDATE registration_questions SET label = :label, required = :required, options = :options, position = :position
+		WHERE id = :id AND event_id = :event_id
+		RETURNING ` + questionColumns
+	query, args, err := db.BindNamed(query, question)
+	if err != nil {
+		log.Printf("Error binding question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
+		return
+	}
+	if err := db.Get(&question, query, args...); err != nil {
+		log.Printf("Error updating question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update question"})
+		return
+	}
+
+	c.JSON(http.StatusOK, question)
+}
+
+func HandleDeleteQuestion(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	questionID, ok := idParam(c, "question_id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	// The answers given to the question are deleted with it.
+	result, err := db.Exec("DELETE FROM registration_questions WHERE id = $1 AND event_id = $2", questionID, eventID)
+	if err != nil {
+		log.Printf("Error deleting question: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Question deleted"})
+}
+
+// loadQuestions returns the questions of an event in form order.
+func loadQuestions(ctx context.Context, db sqlx.QueryerContext, eventID int) ([]models.Question, error) {
+	questions := []models.Question{}
+	query := "SELECT " + questionColumns + " FROM registration_questions WHERE event_id = $1 ORDER BY position, id"
+	err := sqlx.SelectContext(ctx, db, &questions, query, eventID)
+	return questions, err
+}
+
+// validateAnswers checks answers against the event's questions and returns
+// them normalised and encoded for storage. Unanswered optional questions
+// are left out.
+func validateAnswers(questions []models.Question, answers models.Answers) (map[int][]byte, error) {
+	for id := range answers {
+		if !slices.ContainsFunc(questions, func(q models.Question) bool { return q.ID == id }) {
+			return nil, &answerError{QuestionID: id, Reason: "no such question"}
+		}
+	}
+
+	valid := make(map[int][]byte)
+	for _, question := range questions {
+		raw, ok := answers[question.ID]
+		if !ok || string(raw) == "null" {
+			if question.Required {
+				return nil, &answerError{QuestionID: question.ID, Reason: "an answer is required"}
+			}
+			continue
+		}
+		value, err := normaliseAnswer(question, raw)
+		if err != nil {
+			return nil, &answerError{QuestionID: question.ID, Reason: err.Error()}
+		}
+		if value == nil {
+			continue
+		}
+		if valid[question.ID], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return valid, nil
+}
+
+// normaliseAnswer decodes one answer for question. It returns nil for an
+// empty answer to an optional question.
+func normaliseAnswer(question models.Question, raw json.RawMessage) (any, error) {
+	switch question.Kind {
+	case models.QuestionText:
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, errors.New("expected text")
+		}
+		text = strings.TrimSpace(text)
+		if len(text) > maxTextAnswer {
+			return nil, fmt.Errorf("must be at most %d characters", maxTextAnswer)
+		}
+		if text == "" {
+			return emptyAnswer(question)
+		}
+		return text, nil
+	case models.QuestionNumber:
+		var number float64
+		if err := json.Unmarshal(raw, &number); err != nil {
+			return nil, errors.New("expected a number")
+		}
+		return number, nil
+	case models.QuestionCheckbox:
+		var checked bool
+		if err := json.Unmarshal(raw, &checked); err != nil {
+			return nil, errors.New("expected true or false")
+		}
+		if !checked && question.Required {
+			return nil, errors.New("must be checked")
+		}
+		return checked, nil
+	case models.QuestionSingleChoice:
+		var choice string
+		if err := json.Unmarshal(raw, &choice); err != nil {
+			return nil, errors.New("expected one of the options")
+		}
+		if !slices.Contains(question.Options, choice) {
+			return nil, errors.New("not one of the options")
+		}
+		return choice, nil
+	case models.QuestionMultiChoice:
+		var choices []string
+		if err := json.Unmarshal(raw, &choices); err != nil {
+			return nil, errors.New("expected a list of options")
+		}
+		for i, choice := range choices {
+			if !slices.Contains(question.Options, choice) {
+				return nil, fmt.Errorf("%q is not one of the options", choice)
+			}
+			if slices.Contains(choices[:i], choice) {
+				return nil, fmt.Errorf("%q is chosen twice", choice)
+			}
+		}
+		if len(choices) == 0 {
+			return emptyAnswer(question)
+		}
+		return choices, nil
+	default:
+		return nil, fmt.Errorf("unknown question kind %s", question.Kind)
+	}
+}
+
+func emptyAnswer(question models.Question) (any, error) {
+	if question.Required {
+		return nil, errors.New("an answer is required")
+	}
+	return nil, nil
+}
+
+// saveAnswers stores the validated answers of a registration.
+func saveAnswers(ctx context.Context, tx *sqlx.Tx, registrationID int, answers map[int][]byte) error {
+	query := "INSERT INTO registration_answers (registration_id, question_id, value) VALUES ($1, $2, $3)"
+	for questionID, value := range answers {
+		if _, err := tx.ExecContext(ctx, query, registrationID, questionID, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportAnswer turns a stored answer into a spreadsheet cell.
+func exportAnswer(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return string(raw)
+	}
+	if choices, ok := value.([]any); ok {
+		parts := make([]string, len(choices))
+		for i, choice := range choices {
+			parts[i] = fmt.Sprint(choice)
+		}
+		return strings.Join(parts, "; ")
+	}
+	return value
+}
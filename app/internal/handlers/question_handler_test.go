@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"homework/app/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormaliseAnswer(t *testing.T) {
+	text := models.Question{Kind: models.QuestionText}
+	requiredText := models.Question{Kind: models.QuestionText, Required: true}
+	number := models.Question{Kind: models.QuestionNumber}
+	checkbox := models.Question{Kind: models.QuestionCheckbox}
+	consent := models.Question{Kind: models.QuestionCheckbox, Required: true}
+	size := models.Question{Kind: models.QuestionSingleChoice, Options: []string{"S", "M", "L"}}
+	diet := models.Question{Kind: models.QuestionMultiChoice, Options: []string{"vegan", "halal", "nut-free"}}
+	requiredDiet := models.Question{Kind: models.QuestionMultiChoice, Options: diet.Options, Required: true}
+
+	tests := []struct {
+		name     string
+		question models.Question
+		raw      string
+		want     any
+		wantErr  string
+	}{
+		{"text trimmed", text, `"  hello "`, "hello", ""},
+		{"blank optional text", text, `"   "`, nil, ""},
+		{"blank required text", requiredText, `""`, nil, "an answer is required"},
+		{"text too long", text, `"` + strings.Repeat("x", maxTextAnswer+1) + `"`, nil, "must be at most 2000 characters"},
+		{"text as number", text, `42`, nil, "expected text"},
+		{"number", number, `2.5`, 2.5, ""},
+		{"number as text", number, `"2"`, nil, "expected a number"},
+		{"checkbox unticked", checkbox, `false`, false, ""},
+		{"consent ticked", consent, `true`, true, ""},
+		{"consent unticked", consent, `false`, nil, "must be checked"},
+		{"checkbox as text", checkbox, `"yes"`, nil, "expected true or false"},
+		{"single choice", size, `"M"`, "M", ""},
+		{"single choice out of options", size, `"XL"`, nil, "not one of the options"},
+		{"single choice as list", size, `["M"]`, nil, "expected one of the options"},
+		{"multi choice", diet, `["halal", "vegan"]`, []string{"halal", "vegan"}, ""},
+		{"multi choice empty optional", diet, `[]`, nil, ""},
+		{"multi choice empty required", requiredDiet, `[]`, nil, "an answer is required"},
+		{"multi choice out of options", diet, `["vegan", "keto"]`, nil, `"keto" is not one of the options`},
+		{"multi choice repeated", diet, `["vegan", "vegan"]`, nil, `"vegan" is chosen twice`},
+		{"multi choice as text", diet, `"vegan"`, nil, "expected a list of options"},
+		{"unknown kind", models.Question{Kind: "date"}, `"2026-10-19"`, nil, "unknown question kind date"},
+	}
+	for _, tt := range tests {
+		got, err := normaliseAnswer(tt.question, json.RawMessage(tt.raw))
+		if errString(err) != tt.wantErr {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: normaliseAnswer = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAnswers(t *testing.T) {
+	questions := []models.Question{
+		{ID: 1, Kind: models.QuestionText, Required: true},
+		{ID: 2, Kind: models.QuestionNumber},
+		{ID: 3, Kind: models.QuestionMultiChoice, Options: []string{"vegan", "halal"}},
+	}
+	tests := []struct {
+		name    string
+		answers models.Answers
+		want    map[int]string
+		wantErr string
+	}{
+		{"all answered", models.Answers{1: json.RawMessage(`" Ada "`), 2: json.RawMessage(`3`), 3: json.RawMessage(`["vegan"]`)},
+			map[int]string{1: `"Ada"`, 2: `3`, 3: `["vegan"]`}, ""},
+		{"optional left out", models.Answers{1: json.RawMessage(`"Ada"`), 2: json.RawMessage(`null`), 3: json.RawMessage(`[]`)},
+			map[int]string{1: `"Ada"`}, ""},
+		{"required missing", models.Answers{2: json.RawMessage(`3`)}, nil, "question 1: an answer is required"},
+		{"required null", models.Answers{1: json.RawMessage(`null`)}, nil, "question 1: an answer is required"},
+		{"unknown question", models.Answers{1: json.RawMessage(`"Ada"`), 9: json.RawMessage(`"?"`)}, nil, "question 9: no such question"},
+		{"invalid answer", models.Answers{1: json.RawMessage(`"Ada"`), 2: json.RawMessage(`"three"`)}, nil, "question 2: expected a number"},
+	}
+	for _, tt := range tests {
+		got, err := validateAnswers(questions, tt.answers)
+		if errString(err) != tt.wantErr {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr != "" {
+			continue
+		}
+		encoded := make(map[int]string, len(got))
+		for id, value := range got {
+			encoded[id] = string(value)
+		}
+		if !reflect.DeepEqual(encoded, tt.want) {
+			t.Errorf("%s: validateAnswers = %v, want %v", tt.name, encoded, tt.want)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
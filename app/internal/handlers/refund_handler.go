@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const ledgerColumns = "id, registration_id, event_id, kind, amount, currency, provider, reference, note, created_at"
+
+func HandleSetRefundPolicy(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var payload models.RefundPolicyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	// The policy in force when a participant cancels applies; refunds
+	// already owed are not recomputed.
+	var policy models.RefundPolicy
+	query := `INSERT INTO refund_policies (event_id, full_refund_days, partial_refund_days, partial_refund_percent)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (event_id) DO UPDATE SET full_refund_days = excluded.full_refund_days,
+			partial_refund_days = excluded.partial_refund_days,
+			partial_refund_percent = excluded.partial_refund_percent,
+			updated_at = now()
+		RETURNING event_id, full_refund_days, partial_refund_days, partial_refund_percent, updated_at`
+	err := db.Get(&policy, query, eventID, payload.FullRefundDays, payload.PartialRefundDays, payload.PartialRefundPercent)
+	if err != nil {
+		log.Printf("Error saving refund policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save refund policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func HandleGetRefundPolicy(c *gin.Context, db *sqlx.DB) {
+	userID, ok := optionalUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventAccess(c, db, eventID, userID); !ok {
+		return
+	}
+
+	var policy models.RefundPolicy
+	query := "SELECT event_id, full_refund_days, partial_refund_days, partial_refund_percent, updated_at FROM refund_policies WHERE event_id = $1"
+	if err := db.Get(&policy, query, eventID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event has no refund policy; cancellations are refunded in full"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching refund policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refund policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func HandleDeleteRefundPolicy(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM refund_policies WHERE event_id = $1", eventID)
+	if err != nil {
+		log.Printf("Error deleting refund policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete refund policy"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event has no refund policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Refund policy deleted"})
+}
+
+// HandleListLedger returns every payment and refund recorded for an event,
+// oldest first.
+func HandleListLedger(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	entries := []models.LedgerEntry{}
+	query := "SELECT " + ledgerColumns + " FROM payment_ledger WHERE event_id = $1 ORDER BY id"
+	if err := db.Select(&entries, query, eventID); err != nil {
+		log.Printf("Error fetching ledger: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// refundDue computes how much of amount a participant cancelling now gets
+// back under the event's refund policy, with a note explaining why for the
+// ledger.
+func refundDue(ctx context.Context, tx *sqlx.Tx, eventID int, amount int64) (int64, string, error) {
+	var policy models.RefundPolicy
+	query := "SELECT event_id, full_refund_days, partial_refund_days, partial_refund_percent, updated_at FROM refund_policies WHERE event_id = $1"
+	if err := tx.GetContext(ctx, &policy, query, eventID); err == sql.ErrNoRows {
+		return amount, "Cancelled by participant; event has no refund policy, full refund", nil
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	var startsAt time.Time
+	query = "SELECT date_event + start_time::time FROM events WHERE id = $1"
+	if err := tx.GetContext(ctx, &startsAt, query, eventID); err != nil {
+		return 0, "", err
+	}
+	refund, note := refundUnderPolicy(policy, time.Until(startsAt), amount)
+	return refund, note, nil
+}
+
+// refundUnderPolicy computes the refund of amount for a cancellation
+// remaining before the event starts.
+func refundUnderPolicy(policy models.RefundPolicy, remaining time.Duration, amount int64) (int64, string) {
+	switch {
+	case remaining >= days(policy.FullRefundDays):
+		return amount, fmt.Sprintf("Cancelled at least %d days before the event, full refund", policy.FullRefundDays)
+	case remaining >= days(policy.PartialRefundDays):
+		return amount * int64(policy.PartialRefundPercent) / 100,
+			fmt.Sprintf("Cancelled at least %d days before the event, %d%% refund", policy.PartialRefundDays, policy.PartialRefundPercent)
+	default:
+		return 0, fmt.Sprintf("Cancelled less than %d days before the event, no refund", policy.PartialRefundDays)
+	}
+}
+
+// refundCancelledEvent refunds every confirmed paid registration of an event
+// the organizer cancelled in full, whatever the refund policy.
+func refundCancelledEvent(ctx context.Context, tx *sqlx.Tx, eventID int) error {
+	var registrations []models.Registration
+	query := "SELECT " + registrationPaymentColumns + ` FROM registrations
+		WHERE event_id = $1 AND status = 'confirmed' AND payment_id IS NOT NULL AND amount > 0 AND refund_amount = 0 AND refunded_at IS NULL`
+	if err := tx.SelectContext(ctx, &registrations, query, eventID); err != nil {
+		return err
+	}
+	for _, registration := range registrations {
+		if err := scheduleRefund(ctx, tx, refundJob{
+			RegistrationID: registration.ID,
+			EventID:        eventID,
+			PaymentID:      *registration.PaymentID,
+			Amount:         registration.Amount,
+			Currency:       registration.Currency,
+			Note:           "Event cancelled by the organizer, full refund",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// recordLedgerEntry appends entry to the ledger. The provider's reference
+// is unique per kind, so recording the same payment or refund twice, as a
+// retried webhook or job would, keeps a single entry.
+func recordLedgerEntry(ctx context.Context, tx *sqlx.Tx, entry models.LedgerEntry) error {
+	query := `INSERT INTO payment_ledger (registration_id, event_id, kind, amount, currency, provider, reference, note)
+		VALUES (:registration_id, :event_id, :kind, :amount, :currency, :provider, :reference, :note)
+		ON CONFLICT (provider, kind, reference) DO NOTHING`
+	query, args, err := tx.BindNamed(query, entry)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"homework/app/internal/payments"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRefundUnderPolicy(t *testing.T) {
+	policy := models.RefundPolicy{FullRefundDays: 14, PartialRefundDays: 3, PartialRefundPercent: 40}
+	tests := []struct {
+		remaining time.Duration
+		want      int64
+	}{
+		{30 * 24 * time.Hour, 1000},
+		{14 * 24 * time.Hour, 1000},
+		{14*24*time.Hour - time.Minute, 400},
+		{3 * 24 * time.Hour, 400},
+		{3*24*time.Hour - time.Minute, 0},
+		{time.Hour, 0},
+		{-time.Hour, 0},
+	}
+	for _, tt := range tests {
+		if got, note := refundUnderPolicy(policy, tt.remaining, 1000); got != tt.want || note == "" {
+			t.Errorf("refund %v before the event = %d (%q), want %d", tt.remaining, got, note, tt.want)
+		}
+	}
+
+	// Partial refunds are rounded down to whole minor units.
+	if got, _ := refundUnderPolicy(models.RefundPolicy{FullRefundDays: 10, PartialRefundPercent: 33}, time.Hour, 1001); got != 330 {
+		t.Errorf("33%% of 1001 = %d, want 330", got)
+	}
+}
+
+// payForSeat holds a seat for participantID and completes its payment.
+func payForSeat(t *testing.T, db *sqlx.DB, eventID, participantID int) models.Registration {
+	t.Helper()
+	held := holdSeat(t, db, eventID, participantID)
+	payment := payments.WebhookEvent{Type: payments.EventCheckoutCompleted, CheckoutID: "cs_test", PaymentID: "pi_1", Amount: held.Amount, Currency: held.Currency}
+	if err := processPaymentEvent(context.Background(), db, broker.NewLocal(), payment); err != nil {
+		t.Fatalf("pay for seat: %v", err)
+	}
+	return loadRegistration(t, db, held.ID)
+}
+
+func TestCancellationIsRefundedUnderPolicy(t *testing.T) {
+	db := testDB(t)
+	owner := createUser(t, db, "owner")
+	alice := createUser(t, db, "alice")
+	event := createEvent(t, db, owner, intPtr(10))
+
+	// The event is a week away: past the full refund window, within the
+	// partial one.
+	handler := func(c *gin.Context) { HandleSetRefundPolicy(c, db) }
+	policy := gin.H{"full_refund_days": 14, "partial_refund_days": 3, "partial_refund_percent": 50}
+	expectStatus(t, perform(t, handler, "owner", http.MethodPut, "/events/:id/refund-policy", "/events/"+strconv.Itoa(event.ID)+"/refund-policy", policy), http.StatusOK)
+
+	registration := payForSeat(t, db, event.ID, alice)
+	expectStatus(t, cancelFor(t, db, broker.NewLocal(), "alice", event.ID), http.StatusOK)
+
+	registration = loadRegistration(t, db, registration.ID)
+	if registration.Status != models.RegistrationCancelled || registration.RefundAmount != 1250 {
+		t.Fatalf("registration = %s with refund %d, want cancelled with 1250", registration.Status, registration.RefundAmount)
+	}
+	if n := countRows(t, db, "SELECT count(*) FROM jobs WHERE kind = $1", jobRefund); n != 1 {
+		t.Errorf("%d refunds scheduled, want 1", n)
+	}
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"homework/app/internal/broker"
 	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"homework/app/internal/payments"
+	"homework/app/internal/webhooks"
 	"log"
 	"net/http"
 	"time"
@@ -12,7 +18,12 @@ import (
 	"github.com/lib/pq"
 )
 
-func HandleRegistrationEvent(c *gin.Context, db *sqlx.DB) {
+func HandleRegistrationEvent(c *gin.Context, db *sqlx.DB, hub broker.Broker, provider payments.PaymentProvider) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
 	var payload models.RegistrationEventPayload
 
 	if err := c.BindJSON(&payload); err != nil {
@@ -21,20 +32,46 @@ func HandleRegistrationEvent(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the event serialises registrations so capacity cannot be oversold.
 	var event models.Event
-	query := "SELECT id FROM events WHERE id = $1"
+	query := "SELECT id, name, created_by, participant_count, capacity, cancelled_at, requires_approval, visibility, status FROM events WHERE id = $1 FOR UPDATE"
 	log.Printf("Executing query: %s with EventID: %d", query, payload.EventID)
-	err := db.Get(&event, query, payload.EventID)
+	err = tx.Get(&event, query, payload.EventID)
 	if err != nil {
 		log.Printf("Error fetching event: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Event not found"})
 		return
 	}
+	if !registrationOpen(c, event) {
+		return
+	}
+	if event.Visibility == models.VisibilityPrivate {
+		admitted, err := admitToPrivateEvent(c.Request.Context(), tx, event, userID, payload.Invite)
+		if err != nil {
+			log.Printf("Error checking invite: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+			return
+		}
+		if !admitted && payload.Invite != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invite is invalid, expired or used up"})
+			return
+		} else if !admitted {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Event not found"})
+			return
+		}
+	}
 
 	var existingRegistration models.Registration
-	query = "SELECT id FROM registrations WHERE event_id = $1 AND participant_id = $2"
-	log.Printf("Checking registration with query: %s (event_id: %d, participant_id: %d)", query, payload.EventID, payload.ParticipantID)
-	err = db.Get(&existingRegistration, query, payload.EventID, payload.ParticipantID)
+	query = "SELECT id FROM registrations WHERE event_id = $1 AND participant_id = $2 AND status NOT IN ('cancelled', 'expired', 'rejected')"
+	log.Printf("Checking registration with query: %s (event_id: %d, participant_id: %d)", query, payload.EventID, userID)
+	err = tx.Get(&existingRegistration, query, payload.EventID, userID)
 	if err == nil {
 		log.Printf("Participant already registered (Registration ID: %d)", existingRegistration.ID)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Participant already registered"})
@@ -45,40 +82,431 @@ func HandleRegistrationEvent(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
+	questions, err := loadQuestions(c.Request.Context(), tx, event.ID)
+	if err != nil {
+		log.Printf("Error fetching questions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+		return
+	}
+	answers, err := validateAnswers(questions, payload.Answers)
+	var invalidAnswer *answerError
+	if errors.As(err, &invalidAnswer) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid answers", "question_id": invalidAnswer.QuestionID, "details": invalidAnswer.Reason})
+		return
+	} else if err != nil {
+		log.Printf("Error validating answers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+		return
+	}
+
+	quantity := max(payload.Quantity, 1+len(payload.Guests))
+	if payload.Quantity != 0 && payload.Quantity < quantity {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "More guests than seats"})
+		return
+	}
+	ticketType, err := reserveTicketType(c.Request.Context(), tx, event.ID, payload.TicketTypeID, quantity)
+	if isOrderError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Printf("Error checking ticket type: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+		return
+	}
+
 	registration := models.Registration{
 		EventID:          payload.EventID,
-		ParticipantID:    payload.ParticipantID,
+		ParticipantID:    userID,
 		RegistrationDate: time.Now(),
+		Status:           models.RegistrationConfirmed,
+		TicketTypeID:     payload.TicketTypeID,
+		Quantity:         quantity,
+	}
+	var subtotal int64
+	if ticketType != nil {
+		subtotal = ticketType.Price * int64(quantity)
+		registration.Currency = ticketType.Currency
+	}
+	var promo *models.PromoCode
+	if payload.PromoCode != "" {
+		promo, registration.Discount, err = redeemPromoCode(c.Request.Context(), tx, event.ID, userID, payload.PromoCode, ticketType, subtotal)
+		if isOrderError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			log.Printf("Error checking promo code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+			return
+		}
+		registration.PromoCodeID = &promo.ID
 	}
-	query = "INSERT INTO registrations (event_id, participant_id, registration_date) VALUES (:event_id, :participant_id, :registration_date) RETURNING id"
+	registration.Amount = subtotal - registration.Discount
+	if event.RequiresApproval {
+		// Seats and payment wait for the organizer's decision.
+		registration.Status = models.RegistrationPending
+	} else {
+		registration.Status = seatStatus(event, ticketType, quantity, registration.Amount)
+	}
+	if registration.Status == models.RegistrationPendingPayment {
+		deadline := payments.HoldDeadline()
+		registration.HoldExpiresAt = &deadline
+	}
+
+	query = "INSERT INTO registrations (event_id, participant_id, registration_date, status, ticket_type_id, quantity, amount, currency, hold_expires_at, promo_code_id, discount) VALUES (:event_id, :participant_id, :registration_date, :status, :ticket_type_id, :quantity, :amount, :currency, :hold_expires_at, :promo_code_id, :discount) RETURNING id"
 	log.Printf("Inserting registration with query: %s", query)
-	rows, err := db.NamedQuery(query, registration)
+	rows, err := tx.NamedQuery(query, registration)
 	if err != nil {
 		log.Printf("Error inserting registration: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
 		return
 	}
-	defer rows.Close()
 
 	if rows.Next() {
 		err := rows.Scan(&registration.ID)
 		if err != nil {
+			rows.Close()
 			log.Printf("Error scanning registration ID: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve registration ID"})
 			return
 		}
 	}
+	rows.Close()
 
-	query = "UPDATE events SET participant_count = participant_count + 1 WHERE id = $1"
-	log.Printf("Updating participant count with query: %s (event_id: %d)", query, payload.EventID)
-	_, err = db.Exec(query, payload.EventID)
+	if err := saveAnswers(c.Request.Context(), tx, registration.ID, answers); err != nil {
+		log.Printf("Error saving answers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+		return
+	}
+	guests, err := insertGuests(c.Request.Context(), tx, registration.ID, payload.Guests)
 	if err != nil {
+		log.Printf("Error saving guests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+		return
+	}
+
+	if registration.Status == models.RegistrationWaitlisted || registration.Status == models.RegistrationPending {
+		message := "Event is full, added to the waitlist"
+		if registration.Status == models.RegistrationPending {
+			message = "Application received, awaiting organizer approval"
+			if err := notifications.NotifyOrganizers(c.Request.Context(), tx, event.ID, notifications.KindNewApplication,
+				"New application for "+event.Name, "An applicant is waiting for your approval."); err != nil {
+				log.Printf("Error notifying organizer: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+			return
+		}
+		response := gin.H{"message": message, "registration_id": registration.ID, "status": registration.Status, "guests": guests}
+		if ticketType != nil {
+			response["price"] = priceBreakdown(*ticketType, registration, promo)
+		}
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	log.Printf("Confirming %d seat(s) for event %d", quantity, payload.EventID)
+	if err := confirmSeats(c.Request.Context(), tx, registration); err != nil {
 		log.Printf("Error updating participant count: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update participant count"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Registration successful", "registration_id": registration.ID})
+	if registration.Status == models.RegistrationPendingPayment {
+		err = scheduleHoldExpiry(c.Request.Context(), tx, registration)
+	} else {
+		err = announceRegistration(c.Request.Context(), tx, event, registration)
+	}
+	if err != nil {
+		log.Printf("Error announcing registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register participant"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	publishEventState(c.Request.Context(), db, hub, event.ID)
+
+	response := gin.H{"message": "Registration successful", "registration_id": registration.ID, "status": registration.Status, "quantity": registration.Quantity, "guests": guests}
+	if ticketType != nil {
+		response["ticket_type_id"] = ticketType.ID
+		response["total"] = registration.Amount
+		response["currency"] = registration.Currency
+		response["price"] = priceBreakdown(*ticketType, registration, promo)
+	}
+	if registration.Status != models.RegistrationPendingPayment {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	response["hold_expires_at"] = registration.HoldExpiresAt
+	// The seat is already held; if the provider is unavailable the
+	// participant can start the checkout again until the hold expires.
+	if err := startCheckout(c.Request.Context(), db, provider, &registration, event.Name); err != nil {
+		log.Printf("Error starting checkout: %v", err)
+		response["error"] = "Failed to start checkout, retry with POST /registrations/:id/checkout"
+		c.JSON(http.StatusBadGateway, response)
+		return
+	}
+	response["message"] = "Seat held, complete the checkout to confirm"
+	response["checkout_url"] = registration.CheckoutURL
+	c.JSON(http.StatusAccepted, response)
+}
+
+// registrationOpen reports whether event takes registrations, which only
+// published events do. If not it writes the error response; drafts are
+// reported as missing.
+func registrationOpen(c *gin.Context, event models.Event) bool {
+	switch event.Status {
+	case models.EventPublished:
+		return true
+	case models.EventCancelled:
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has been cancelled"})
+	case models.EventCompleted:
+		c.JSON(http.StatusConflict, gin.H{"error": "Event has already taken place"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event not found"})
+	}
+	return false
+}
+
+// priceBreakdown explains how the amount charged for a registration was
+// arrived at.
+func priceBreakdown(ticketType models.TicketType, registration models.Registration, promo *models.PromoCode) gin.H {
+	breakdown := gin.H{
+		"unit_price": ticketType.Price,
+		"quantity":   registration.Quantity,
+		"subtotal":   ticketType.Price * int64(registration.Quantity),
+		"discount":   registration.Discount,
+		"total":      registration.Amount,
+		"currency":   registration.Currency,
+	}
+	if promo != nil {
+		breakdown["promo_code"] = promo.Code
+	}
+	return breakdown
+}
+
+// announceRegistration tells the organizers and their webhooks about a newly
+// confirmed registration.
+func announceRegistration(ctx context.Context, tx *sqlx.Tx, event models.Event, registration models.Registration) error {
+	if err := webhooks.PublishToOrganizers(ctx, tx, event.ID, webhooks.EventRegistrationCreated, registration); err != nil {
+		return err
+	}
+	return notifications.NotifyOrganizers(ctx, tx, event.ID, notifications.KindNewRegistration,
+		"New registration for "+event.Name, "")
+}
+
+// seatStatus decides where a registration for quantity seats costing amount
+// goes: onto the waitlist while the event or its ticket type lacks room for
+// it, otherwise to a confirmed seat, or to one held until paid for.
+func seatStatus(event models.Event, ticketType *models.TicketType, quantity int, amount int64) string {
+	switch {
+	case event.Capacity != nil && event.ParticipantCount+quantity > *event.Capacity:
+		return models.RegistrationWaitlisted
+	case ticketType != nil && ticketType.Sold+quantity > ticketType.Quantity:
+		return models.RegistrationWaitlisted
+	case amount > 0:
+		return models.RegistrationPendingPayment
+	default:
+		return models.RegistrationConfirmed
+	}
+}
+
+// promoteWaitlisted gives free seats to waitlisted registrations, oldest
+// first. Free tickets are confirmed; paid ones are held awaiting payment.
+// The caller must hold the event row lock.
+func promoteWaitlisted(ctx context.Context, tx *sqlx.Tx, eventID int) error {
+	var event models.Event
+	query := "SELECT id, name, created_by, participant_count, capacity, status FROM events WHERE id = $1"
+	if err := tx.GetContext(ctx, &event, query, eventID); err != nil {
+		return err
+	}
+	if event.Status != models.EventPublished {
+		return nil
+	}
+
+	for event.Capacity == nil || event.ParticipantCount < *event.Capacity {
+		var free *int
+		if event.Capacity != nil {
+			seats := *event.Capacity - event.ParticipantCount
+			free = &seats
+		}
+
+		// The oldest registration that fits both the free seats and what is
+		// left of its ticket type goes first.
+		var registration models.Registration
+		query = `UPDATE registrations SET
+				status = CASE WHEN amount > 0 THEN 'pending_payment' ELSE 'confirmed' END,
+				hold_expires_at = CASE WHEN amount > 0 THEN $3::timestamptz END
+			WHERE id = (
+				SELECT r.id FROM registrations r
+				LEFT JOIN ticket_types t ON t.id = r.ticket_type_id
+				WHERE r.event_id = $1 AND r.status = 'waitlisted'
+					AND ($2::int IS NULL OR r.quantity <= $2)
+					AND (t.id IS NULL OR t.sold + r.quantity <= t.quantity)
+				ORDER BY r.id LIMIT 1
+			)
+			RETURNING id, event_id, participant_id, registration_date, status, cancelled_at, ticket_type_id, quantity, amount, currency, hold_expires_at`
+		err := tx.GetContext(ctx, &registration, query, eventID, free, payments.HoldDeadline())
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := confirmSeats(ctx, tx, registration); err != nil {
+			return err
+		}
+		event.ParticipantCount += registration.Quantity
+
+		if registration.Status == models.RegistrationPendingPayment {
+			if err := scheduleHoldExpiry(ctx, tx, registration); err != nil {
+				return err
+			}
+			if err := notifications.Notify(ctx, tx, registration.ParticipantID, notifications.KindWaitlistPromoted,
+				"A seat is held for you at "+event.Name, "Complete the checkout before "+registration.HoldExpiresAt.UTC().Format(time.RFC1123)+" to confirm it.", eventID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := notifications.Notify(ctx, tx, registration.ParticipantID, notifications.KindWaitlistPromoted,
+			"You got a seat at "+event.Name, "A seat became available and your registration is now confirmed.", eventID); err != nil {
+			return err
+		}
+		if err := announceRegistration(ctx, tx, event, registration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func HandleCancelRegistration(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	var payload models.CancelRegistrationPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var event models.Event
+	query := "SELECT id, created_by, status FROM events WHERE id = $1 FOR UPDATE"
+	if err := tx.Get(&event, query, payload.EventID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+		return
+	}
+	// Cancelling the event already refunded its registrations in full.
+	if event.Status == models.EventCancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event was cancelled; registrations are refunded by the organizer", "status": event.Status})
+		return
+	}
+
+	var previousStatus string
+	query = `SELECT status FROM registrations
+		WHERE event_id = $1 AND participant_id = $2 AND status NOT IN ('cancelled', 'expired', 'rejected')`
+	if err := tx.Get(&previousStatus, query, payload.EventID, userID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+		return
+	}
+
+	var registration models.Registration
+	query = `UPDATE registrations SET status = 'cancelled', cancelled_at = now()
+		WHERE event_id = $1 AND participant_id = $2 AND status NOT IN ('cancelled', 'expired', 'rejected')
+		RETURNING ` + registrationPaymentColumns
+	if err := tx.Get(&registration, query, payload.EventID, userID); err != nil {
+		log.Printf("Error cancelling registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+		return
+	}
+
+	if err := cancelPendingTransfers(c.Request.Context(), tx, registration.ID); err != nil {
+		log.Printf("Error cancelling transfers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+		return
+	}
+
+	if previousStatus == models.RegistrationConfirmed || previousStatus == models.RegistrationPendingPayment {
+		if err := releaseSeats(c.Request.Context(), tx, registration); err != nil {
+			log.Printf("Error updating participant count: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update participant count"})
+			return
+		}
+
+		// Unpaid holds were never announced as registrations.
+		if previousStatus == models.RegistrationConfirmed {
+			if err := webhooks.PublishToOrganizers(c.Request.Context(), tx, event.ID, webhooks.EventRegistrationCancelled, registration); err != nil {
+				log.Printf("Error publishing webhook: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+				return
+			}
+		}
+
+		if err := promoteWaitlisted(c.Request.Context(), tx, payload.EventID); err != nil {
+			log.Printf("Error promoting waitlist: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+			return
+		}
+	}
+
+	// A hold cancelled before its checkout completed has nothing to refund;
+	// if the payment still arrives it is refunded in full. So is a payment
+	// of the wrong amount, which has its refund scheduled already.
+	response := gin.H{"message": "Registration cancelled", "registration_id": registration.ID}
+	if registration.PaymentID != nil && registration.Amount > 0 && registration.RefundAmount == 0 {
+		refund, note, err := refundDue(c.Request.Context(), tx, payload.EventID, registration.Amount)
+		if err != nil {
+			log.Printf("Error computing refund: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+			return
+		}
+		if refund > 0 {
+			if err := scheduleRefund(c.Request.Context(), tx, refundJob{
+				RegistrationID: registration.ID,
+				EventID:        payload.EventID,
+				PaymentID:      *registration.PaymentID,
+				Amount:         refund,
+				Currency:       registration.Currency,
+				Note:           note,
+			}); err != nil {
+				log.Printf("Error scheduling refund: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
+				return
+			}
+		}
+		response["refund"] = gin.H{"amount": refund, "currency": registration.Currency, "reason": note}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	publishEventState(c.Request.Context(), db, hub, payload.EventID)
+
+	c.JSON(http.StatusOK, response)
 }
 
 func HandleListRegistrations(c *gin.Context, db *sqlx.DB) {
@@ -97,7 +525,7 @@ func HandleListRegistrations(c *gin.Context, db *sqlx.DB) {
 	}
 
 	var registrations []models.Registration
-	query = "select event_id from registrations where participant_id = $1"
+	query = "select event_id from registrations where participant_id = $1 and status not in ('cancelled', 'expired', 'rejected')"
 
 	err = db.Select(&registrations, query, user.ID)
 	if err != nil {
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"homework/app/internal/payments"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func registerFor(t *testing.T, db *sqlx.DB, hub broker.Broker, username string, eventID int) map[string]any {
+	t.Helper()
+	provider := payments.NewFake([]byte("test-secret"), "http://localhost")
+	handler := func(c *gin.Context) { HandleRegistrationEvent(c, db, hub, provider) }
+	w := perform(t, handler, username, http.MethodPost, "/register-event", "/register-event", gin.H{"event_id": eventID})
+	if w.Code != http.StatusOK && w.Code != http.StatusAccepted {
+		t.Fatalf("register %s: status %d: %s", username, w.Code, w.Body.String())
+	}
+	return decode(t, w.Body.Bytes())
+}
+
+func cancelFor(t *testing.T, db *sqlx.DB, hub broker.Broker, username string, eventID int) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := func(c *gin.Context) { HandleCancelRegistration(c, db, hub) }
+	return perform(t, handler, username, http.MethodPost, "/cancel-registration", "/cancel-registration", gin.H{"event_id": eventID})
+}
+
+func registrationStatus(t *testing.T, db *sqlx.DB, eventID, participantID int) string {
+	t.Helper()
+	var status string
+	query := "SELECT status FROM registrations WHERE event_id = $1 AND participant_id = $2 ORDER BY id DESC LIMIT 1"
+	if err := db.Get(&status, query, eventID, participantID); err != nil {
+		t.Fatalf("registration status: %v", err)
+	}
+	return status
+}
+
+func participantCount(t *testing.T, db *sqlx.DB, eventID int) int {
+	t.Helper()
+	var count int
+	if err := db.Get(&count, "SELECT participant_count FROM events WHERE id = $1", eventID); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestFullEventWaitlistsAndPromotes(t *testing.T) {
+	db := testDB(t)
+	hub := broker.NewLocal()
+	owner := createUser(t, db, "owner")
+	createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	event := createEvent(t, db, owner, intPtr(1))
+
+	if got := registerFor(t, db, hub, "alice", event.ID)["status"]; got != models.RegistrationConfirmed {
+		t.Fatalf("alice: status %v, want confirmed", got)
+	}
+	if got := registerFor(t, db, hub, "bob", event.ID)["status"]; got != models.RegistrationWaitlisted {
+		t.Fatalf("bob: status %v, want waitlisted", got)
+	}
+	if got := participantCount(t, db, event.ID); got != 1 {
+		t.Fatalf("participant_count = %d, want 1", got)
+	}
+
+	expectStatus(t, cancelFor(t, db, hub, "alice", event.ID), http.StatusOK)
+
+	if got := registrationStatus(t, db, event.ID, bob); got != models.RegistrationConfirmed {
+		t.Fatalf("bob after alice cancelled: %s, want confirmed", got)
+	}
+	if got := participantCount(t, db, event.ID); got != 1 {
+		t.Fatalf("participant_count = %d, want 1", got)
+	}
+	var notified bool
+	query := "SELECT EXISTS (SELECT 1 FROM notifications WHERE user_id = $1 AND kind = $2 AND event_id = $3)"
+	if err := db.Get(&notified, query, bob, notifications.KindWaitlistPromoted, event.ID); err != nil || !notified {
+		t.Fatalf("bob not notified of the promotion (err %v)", err)
+	}
+}
+
+func TestPromotionSkipsGroupsThatDoNotFit(t *testing.T) {
+	db := testDB(t)
+	hub := broker.NewLocal()
+	owner := createUser(t, db, "owner")
+	createUser(t, db, "alice")
+	group := createUser(t, db, "group")
+	carol := createUser(t, db, "carol")
+	event := createEvent(t, db, owner, intPtr(2))
+
+	registerFor(t, db, hub, "alice", event.ID)
+	provider := payments.NewFake([]byte("test-secret"), "http://localhost")
+	handler := func(c *gin.Context) { HandleRegistrationEvent(c, db, hub, provider) }
+	w := perform(t, handler, "group", http.MethodPost, "/register-event", "/register-event", gin.H{"event_id": event.ID, "quantity": 3})
+	expectStatus(t, w, http.StatusAccepted)
+	registerFor(t, db, hub, "carol", event.ID)
+	if got := registrationStatus(t, db, event.ID, carol); got != models.RegistrationConfirmed {
+		t.Fatalf("carol: %s, want confirmed into the second seat", got)
+	}
+
+	expectStatus(t, cancelFor(t, db, hub, "alice", event.ID), http.StatusOK)
+
+	// One seat is free; the group of three still does not fit.
+	if got := registrationStatus(t, db, event.ID, group); got != models.RegistrationWaitlisted {
+		t.Fatalf("group: %s, want still waitlisted", got)
+	}
+	if got := participantCount(t, db, event.ID); got != 1 {
+		t.Fatalf("participant_count = %d, want 1", got)
+	}
+}
+
+func TestRegistrationIsForTheAuthenticatedUser(t *testing.T) {
+	db := testDB(t)
+	hub := broker.NewLocal()
+	owner := createUser(t, db, "owner")
+	alice := createUser(t, db, "alice")
+	event := createEvent(t, db, owner, nil)
+
+	provider := payments.NewFake([]byte("test-secret"), "http://localhost")
+	handler := func(c *gin.Context) { HandleRegistrationEvent(c, db, hub, provider) }
+	w := perform(t, handler, "alice", http.MethodPost, "/register-event", "/register-event", gin.H{"event_id": event.ID, "participant_id": owner})
+	expectStatus(t, w, http.StatusOK)
+
+	var participantID int
+	if err := db.Get(&participantID, "SELECT participant_id FROM registrations WHERE event_id = $1", event.ID); err != nil {
+		t.Fatal(err)
+	}
+	if participantID != alice {
+		t.Fatalf("registered participant %d, want the caller %d", participantID, alice)
+	}
+}
+
+func TestSeatStatus(t *testing.T) {
+	open := models.Event{Capacity: intPtr(10), ParticipantCount: 8}
+	unlimited := models.Event{}
+	tickets := &models.TicketType{Quantity: 5, Sold: 4}
+	tests := []struct {
+		name       string
+		event      models.Event
+		ticketType *models.TicketType
+		quantity   int
+		amount     int64
+		want       string
+	}{
+		{"free seat", open, nil, 2, 0, models.RegistrationConfirmed},
+		{"paid seat", open, nil, 2, 500, models.RegistrationPendingPayment},
+		{"event full", open, nil, 3, 0, models.RegistrationWaitlisted},
+		{"no capacity", unlimited, nil, 100, 0, models.RegistrationConfirmed},
+		{"ticket type has room", unlimited, tickets, 1, 500, models.RegistrationPendingPayment},
+		{"ticket type sold out", unlimited, tickets, 2, 500, models.RegistrationWaitlisted},
+		{"ticket type sold out on full event", open, tickets, 3, 0, models.RegistrationWaitlisted},
+	}
+	for _, tt := range tests {
+		if got := seatStatus(tt.event, tt.ticketType, tt.quantity, tt.amount); got != tt.want {
+			t.Errorf("%s: seatStatus = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSoldOutTicketTypeWaitlists(t *testing.T) {
+	db := testDB(t)
+	hub := broker.NewLocal()
+	owner := createUser(t, db, "owner")
+	createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	event := createEvent(t, db, owner, nil)
+
+	create := func(c *gin.Context) { HandleCreateTicketType(c, db) }
+	path := "/events/" + strconv.Itoa(event.ID) + "/ticket-types"
+	w := perform(t, create, "owner", http.MethodPost, "/events/:id/ticket-types", path, gin.H{"name": "Early bird", "currency": "EUR", "quantity": 1})
+	expectStatus(t, w, http.StatusCreated)
+	ticketTypeID := int(decode(t, w.Body.Bytes())["id"].(float64))
+
+	provider := payments.NewFake([]byte("test-secret"), "http://localhost")
+	register := func(c *gin.Context) { HandleRegistrationEvent(c, db, hub, provider) }
+	body := gin.H{"event_id": event.ID, "ticket_type_id": ticketTypeID}
+	expectStatus(t, perform(t, register, "alice", http.MethodPost, "/register-event", "/register-event", body), http.StatusOK)
+	expectStatus(t, perform(t, register, "bob", http.MethodPost, "/register-event", "/register-event", body), http.StatusAccepted)
+	if got := registrationStatus(t, db, event.ID, bob); got != models.RegistrationWaitlisted {
+		t.Fatalf("bob: %s, want waitlisted for the sold-out ticket type", got)
+	}
+
+	expectStatus(t, cancelFor(t, db, hub, "alice", event.ID), http.StatusOK)
+	if got := registrationStatus(t, db, event.ID, bob); got != models.RegistrationConfirmed {
+		t.Fatalf("bob after alice cancelled: %s, want confirmed", got)
+	}
+}
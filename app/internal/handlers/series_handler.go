@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"homework/app/internal/models"
+	"homework/app/internal/recurrence"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// scopeQuery reads which occurrences of a series an edit applies to,
+// defaulting to the one addressed. On failure it writes the error response
+// and returns false.
+func scopeQuery(c *gin.Context) (string, bool) {
+	scope := c.DefaultQuery("scope", models.ScopeThis)
+	switch scope {
+	case models.ScopeThis, models.ScopeFollowing, models.ScopeAll:
+		return scope, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope, expected this, following or all"})
+	return "", false
+}
+
+func HandleCreateEventSeries(c *gin.Context, db *sqlx.DB, materializer *recurrence.Materializer) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	var payload models.CreateEventSeriesPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	first, err := eventFromPayload(payload.CreateEventPayload, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := recurrence.ParseRule(payload.RRule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	series := models.EventSeries{
+		Name:              first.Name,
+		Description:       first.Description,
+		Location:          first.Location,
+		StartTime:         first.StartTime,
+		EndTime:           first.EndTime,
+		StartDate:         first.Date,
+		RRule:             payload.RRule,
+		Capacity:          first.Capacity,
+		RequiresApproval:  first.RequiresApproval,
+		TransfersEnabled:  first.TransfersEnabled,
+		Visibility:        first.Visibility,
+		PublishedAt:       first.PublishedAt,
+		CreatedBy:         userID,
+		MaterializedUntil: first.Date.AddDate(0, 0, -1),
+	}
+	for _, exdate := range payload.ExDates {
+		parsed, err := time.Parse(models.DateFormat, exdate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exdate format"})
+			return
+		}
+		series.ExDates = append(series.ExDates, parsed)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := insertSeries(c.Request.Context(), tx, &series); err != nil {
+		log.Printf("Error creating event series: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event series"})
+		return
+	}
+	events, err := materializer.Materialize(c.Request.Context(), tx, &series)
+	if err != nil {
+		log.Printf("Error materializing event series: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event series"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Event series created successfully", "series_id": series.ID, "events": events})
+}
+
+// HandleGetEventSeries returns a series and its occurrences. Private and
+// unpublished series are shown only to the organizers of its occurrences,
+// and private and draft occurrences only to their own organizers; invitees
+// reach those through GET /events/:id.
+func HandleGetEventSeries(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	seriesID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var series models.EventSeries
+	query := `SELECT id, name, description, location, start_time, end_time, start_date, rrule, capacity, requires_approval, transfers_enabled, visibility, published_at, created_by, materialized_until, created_at
+		FROM event_series WHERE id = $1`
+	err := db.Get(&series, query, seriesID)
+	if err == nil && (series.Visibility == models.VisibilityPrivate || series.PublishedAt == nil) {
+		query = `SELECT EXISTS (SELECT 1 FROM event_organizers o JOIN events e ON e.id = o.event_id WHERE e.series_id = $1 AND o.user_id = $2)`
+		var organizer bool
+		if err = db.Get(&organizer, query, seriesID, userID); err == nil && !organizer {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event series not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching event series: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event series"})
+		return
+	}
+
+	query = "SELECT exdate FROM event_series_exdates WHERE series_id = $1 ORDER BY exdate"
+	if err := db.Select(&series.ExDates, query, seriesID); err != nil {
+		log.Printf("Error fetching exdates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event series"})
+		return
+	}
+
+	occurrences := []models.Event{}
+	query = "SELECT " + eventColumns + " FROM events WHERE series_id = $1 AND ((visibility <> 'private' AND status <> 'draft') OR id IN (SELECT event_id FROM event_organizers WHERE user_id = $2)) ORDER BY occurrence_date"
+	if err := db.Select(&occurrences, query, seriesID, userID); err != nil {
+		log.Printf("Error fetching occurrences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"series": series, "occurrences": occurrences})
+}
+
+// insertSeries stores a new series together with its exdates.
+func insertSeries(ctx context.Context, tx *sqlx.Tx, series *models.EventSeries) error {
+	query := `INSERT INTO event_series (name, description, location, start_time, end_time, start_date, rrule, capacity, requires_approval, transfers_enabled, visibility, published_at, created_by, materialized_until)
+		VALUES (:name, :description, :location, :start_time, :end_time, :start_date, :rrule, :capacity, :requires_approval, :transfers_enabled, :visibility, :published_at, :created_by, :materialized_until)
+		RETURNING id, created_at`
+	query, args, err := tx.BindNamed(query, series)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&series.ID, &series.CreatedAt); err != nil {
+		return err
+	}
+
+	for _, exdate := range series.ExDates {
+		query = "INSERT INTO event_series_exdates (series_id, exdate) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		if _, err := tx.ExecContext(ctx, query, series.ID, exdate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seriesFrom is the first occurrence date an edit or cancellation with scope
+// covers: the addressed occurrence onwards, or every occurrence from today.
+func seriesFrom(event models.Event, scope string) time.Time {
+	if scope == models.ScopeAll {
+		return recurrence.Day(time.Now().UTC())
+	}
+	return recurrence.Day(*event.OccurrenceDate)
+}
+
+// requireSeriesRole checks that the user holds at least role on every live
+// occurrence an edit with scope reaches, not only on the one addressed. On
+// failure it writes the error response and returns false.
+func requireSeriesRole(c *gin.Context, tx *sqlx.Tx, event models.Event, scope string, userID int, role string) bool {
+	var held []string
+	query := `SELECT COALESCE(o.role, '') FROM events e
+		LEFT JOIN event_organizers o ON o.event_id = e.id AND o.user_id = $3
+		WHERE e.series_id = $1 AND e.occurrence_date >= $2 AND e.status IN ('draft', 'published')`
+	if err := tx.Select(&held, query, *event.SeriesID, seriesFrom(event, scope), userID); err != nil {
+		log.Printf("Error fetching series organizers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return false
+	}
+	if weakest, ok := weakestRole(held); ok && organizerRank[weakest] < organizerRank[role] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your role on some occurrences in scope does not allow this", "role": weakest, "required_role": role})
+		return false
+	}
+	return true
+}
+
+// weakestRole is the lowest ranked of the roles held, "" standing for none.
+// It reports false when there are no roles to compare.
+func weakestRole(held []string) (string, bool) {
+	if len(held) == 0 {
+		return "", false
+	}
+	weakest := held[0]
+	for _, role := range held[1:] {
+		if organizerRank[role] < organizerRank[weakest] {
+			weakest = role
+		}
+	}
+	return weakest, true
+}
+
+// splitSeries ends series the day before at and moves the occurrences from
+// at onwards into a new series with the same template, which it returns.
+func splitSeries(ctx context.Context, tx *sqlx.Tx, series models.EventSeries, at time.Time) (models.EventSeries, error) {
+	head, tail, err := recurrence.Split(series, at)
+	if err != nil {
+		return series, err
+	}
+	query := "UPDATE event_series SET rrule = $1 WHERE id = $2"
+	if _, err := tx.ExecContext(ctx, query, head, series.ID); err != nil {
+		return series, err
+	}
+
+	next := series
+	next.StartDate = at
+	next.RRule = tail
+	next.ExDates = nil
+	for _, exdate := range series.ExDates {
+		if !recurrence.Day(exdate).Before(at) {
+			next.ExDates = append(next.ExDates, exdate)
+		}
+	}
+	if err := insertSeries(ctx, tx, &next); err != nil {
+		return series, err
+	}
+
+	query = "DELETE FROM event_series_exdates WHERE series_id = $1 AND exdate >= $2"
+	if _, err := tx.ExecContext(ctx, query, series.ID, at); err != nil {
+		return series, err
+	}
+	query = "UPDATE events SET series_id = $1 WHERE series_id = $2 AND occurrence_date >= $3"
+	if _, err := tx.ExecContext(ctx, query, next.ID, series.ID, at); err != nil {
+		return series, err
+	}
+	return next, nil
+}
+
+// updateSeries applies payload to the series of event and to its live
+// occurrences within scope that were not edited on their own, and returns
+// the events it changed. Occurrences a new rule no longer produces are
+// cancelled. The caller must hold the event row lock.
+func updateSeries(ctx context.Context, tx *sqlx.Tx, materializer *recurrence.Materializer, event models.Event, scope string, payload models.UpdateEventPayload) ([]models.Event, error) {
+	series, err := recurrence.LoadSeries(ctx, tx, *event.SeriesID)
+	if err != nil {
+		return nil, err
+	}
+	from := seriesFrom(event, scope)
+	if scope == models.ScopeFollowing && from.After(recurrence.Day(series.StartDate)) {
+		if series, err = splitSeries(ctx, tx, series, from); err != nil {
+			return nil, err
+		}
+	}
+
+	template := models.Event{
+		Name:             series.Name,
+		Description:      series.Description,
+		Location:         series.Location,
+		StartTime:        series.StartTime,
+		EndTime:          series.EndTime,
+		Capacity:         series.Capacity,
+		RequiresApproval: series.RequiresApproval,
+		TransfersEnabled: series.TransfersEnabled,
+		Visibility:       series.Visibility,
+	}
+	if err := applyEventUpdate(payload, &template); err != nil {
+		return nil, err
+	}
+	series.Name = template.Name
+	series.Description = template.Description
+	series.Location = template.Location
+	series.StartTime = template.StartTime
+	series.EndTime = template.EndTime
+	series.Capacity = template.Capacity
+	series.RequiresApproval = template.RequiresApproval
+	series.TransfersEnabled = template.TransfersEnabled
+	series.Visibility = template.Visibility
+	if payload.RRule != nil {
+		series.RRule = *payload.RRule
+	}
+
+	query := `UPDATE event_series SET name = :name, description = :description, location = :location,
+		start_time = :start_time, end_time = :end_time, capacity = :capacity, requires_approval = :requires_approval,
+		transfers_enabled = :transfers_enabled, visibility = :visibility, rrule = :rrule WHERE id = :id`
+	if _, err := tx.NamedExecContext(ctx, query, series); err != nil {
+		return nil, err
+	}
+
+	var changed []models.Event
+	query = `UPDATE events SET name = $1, description = $2, location = $3, start_time = $4, end_time = $5, capacity = $6,
+			requires_approval = $7, transfers_enabled = $8, visibility = $9
+		WHERE series_id = $10 AND occurrence_date >= $11 AND NOT detached AND status IN ('draft', 'published')
+		RETURNING ` + eventColumns
+	if err := tx.SelectContext(ctx, &changed, query, series.Name, series.Description, series.Location,
+		series.StartTime, series.EndTime, series.Capacity, series.RequiresApproval, series.TransfersEnabled, series.Visibility, series.ID, from); err != nil {
+		return nil, err
+	}
+	for _, occurrence := range changed {
+		if err := announceEventUpdate(ctx, tx, occurrence); err != nil {
+			return nil, err
+		}
+	}
+
+	if payload.RRule == nil {
+		return changed, nil
+	}
+	stale, err := materializer.Reconcile(ctx, tx, &series, from)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range stale {
+		occurrence, err := cancelEvent(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, occurrence)
+	}
+	return changed, nil
+}
+
+// cancelSeries ends the series of event so no further occurrences are
+// materialized and cancels its live occurrences within scope. The caller
+// must hold the event row lock.
+func cancelSeries(ctx context.Context, tx *sqlx.Tx, event models.Event, scope string) ([]models.Event, error) {
+	series, err := recurrence.LoadSeries(ctx, tx, *event.SeriesID)
+	if err != nil {
+		return nil, err
+	}
+	from := seriesFrom(event, scope)
+
+	head, _, err := recurrence.Split(series, from)
+	if err != nil {
+		return nil, err
+	}
+	query := "UPDATE event_series SET rrule = $1 WHERE id = $2"
+	if _, err := tx.ExecContext(ctx, query, head, series.ID); err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	query = "SELECT id FROM events WHERE series_id = $1 AND occurrence_date >= $2 AND status IN ('draft', 'published') ORDER BY occurrence_date"
+	if err := tx.SelectContext(ctx, &ids, query, series.ID, from); err != nil {
+		return nil, err
+	}
+	var cancelled []models.Event
+	for _, id := range ids {
+		occurrence, err := cancelEvent(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		cancelled = append(cancelled, occurrence)
+	}
+	return cancelled, nil
+}
+
+// publishSeries publishes the series of event, so the occurrences it
+// materializes from now on are live, and publishes its draft occurrences
+// within scope. The caller must hold the event row lock.
+func publishSeries(ctx context.Context, tx *sqlx.Tx, event models.Event, scope string) ([]models.Event, error) {
+	series, err := recurrence.LoadSeries(ctx, tx, *event.SeriesID)
+	if err != nil {
+		return nil, err
+	}
+	query := "UPDATE event_series SET published_at = COALESCE(published_at, now()) WHERE id = $1"
+	if _, err := tx.ExecContext(ctx, query, series.ID); err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	query = "SELECT id FROM events WHERE series_id = $1 AND occurrence_date >= $2 AND status = 'draft' ORDER BY occurrence_date"
+	if err := tx.SelectContext(ctx, &ids, query, series.ID, seriesFrom(event, scope)); err != nil {
+		return nil, err
+	}
+	var published []models.Event
+	for _, id := range ids {
+		occurrence, err := publishEvent(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		published = append(published, occurrence)
+	}
+	return published, nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"homework/app/internal/broker"
+	"homework/app/internal/config"
+	"homework/app/internal/models"
+	"homework/app/internal/recurrence"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// createSeries creates a weekly series of published occurrences owned by
+// username and returns their ids in date order.
+func createSeries(t *testing.T, db *sqlx.DB, materializer *recurrence.Materializer, username string) []int {
+	t.Helper()
+	first := time.Now().AddDate(0, 0, 7)
+	create := func(c *gin.Context) { HandleCreateEventSeries(c, db, materializer) }
+	rec := perform(t, create, username, http.MethodPost, "/event-series", "/event-series", gin.H{
+		"name": "Weekly", "description": "Every week", "location": "Hall",
+		"start_time": "18:00", "end_time": "20:00", "date": first.Format(models.DateFormat),
+		"publish": true, "rrule": "FREQ=WEEKLY;COUNT=3",
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var ids []int
+	for _, event := range decode(t, rec.Body.Bytes())["events"].([]any) {
+		ids = append(ids, int(event.(map[string]any)["id"].(float64)))
+	}
+	if len(ids) != 3 {
+		t.Fatalf("series has %d occurrences, want 3", len(ids))
+	}
+	return ids
+}
+
+func TestSeriesEditsNeedARoleOnEveryOccurrence(t *testing.T) {
+	db := testDB(t)
+	hub := broker.NewLocal()
+	materializer := recurrence.NewMaterializer(db, config.RecurrenceConfig{Horizon: 60 * 24 * time.Hour})
+	createUser(t, db, "owner")
+	createUser(t, db, "editor")
+	ids := createSeries(t, db, materializer, "owner")
+
+	// The editor organizes the first occurrence only.
+	first := "/events/" + strconv.Itoa(ids[0])
+	add := func(c *gin.Context) { HandleAddOrganizer(c, db) }
+	expectStatus(t, perform(t, add, "owner", http.MethodPost, "/events/:id/organizers", first+"/organizers", gin.H{"user": "editor", "role": models.OrganizerEditor}), http.StatusCreated)
+
+	update := func(c *gin.Context) { HandleUpdateEvent(c, db, hub, materializer) }
+	cancel := func(c *gin.Context) { HandleCancelEvent(c, db, hub) }
+	rename := gin.H{"name": "Renamed"}
+	for _, scope := range []string{models.ScopeFollowing, models.ScopeAll} {
+		expectStatus(t, perform(t, update, "editor", http.MethodPut, "/events/:id", first+"?scope="+scope, rename), http.StatusForbidden)
+	}
+	expectStatus(t, perform(t, update, "editor", http.MethodPut, "/events/:id", first+"?scope="+models.ScopeThis, rename), http.StatusOK)
+
+	var names []string
+	if err := db.Select(&names, "SELECT name FROM events WHERE series_id = (SELECT series_id FROM events WHERE id = $1) ORDER BY occurrence_date", ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if names[1] != "Weekly" || names[2] != "Weekly" {
+		t.Errorf("names = %q, want later occurrences untouched", names)
+	}
+
+	// The owner of every occurrence may still act on the whole series.
+	expectStatus(t, perform(t, cancel, "owner", http.MethodPost, "/events/:id/cancel", first+"/cancel?scope="+models.ScopeAll, nil), http.StatusOK)
+}
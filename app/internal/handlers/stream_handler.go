@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+func eventState(ctx context.Context, db *sqlx.DB, eventID int) (broker.Update, error) {
+	var row struct {
+		ParticipantCount int    `db:"participant_count"`
+		Capacity         *int   `db:"capacity"`
+		Status           string `db:"status"`
+	}
+	query := "SELECT participant_count, capacity, status FROM events WHERE id = $1"
+	if err := db.GetContext(ctx, &row, query, eventID); err != nil {
+		return broker.Update{}, err
+	}
+
+	update := broker.Update{EventID: eventID, ParticipantCount: row.ParticipantCount, Capacity: row.Capacity, Status: "open"}
+	if row.Status != models.EventPublished {
+		update.Status = row.Status
+	} else if row.Capacity != nil && row.ParticipantCount >= *row.Capacity {
+		update.Status = "full"
+	}
+	return update, nil
+}
+
+// publishEventState pushes the committed state of an event to live streams.
+// Failures only delay the update until the next change, so they are logged.
+func publishEventState(ctx context.Context, db *sqlx.DB, hub broker.Broker, eventID int) {
+	update, err := eventState(ctx, db, eventID)
+	if err == nil {
+		err = hub.Publish(ctx, update)
+	}
+	if err != nil {
+		log.Printf("Error publishing live update for event %d: %v", eventID, err)
+	}
+}
+
+func HandleEventStream(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventAccess(c, db, eventID, userID); !ok {
+		return
+	}
+
+	// Subscribe before reading the snapshot so no change slips in between.
+	updates, unsubscribe := hub.Subscribe(eventID)
+	defer unsubscribe()
+
+	current, err := eventState(c.Request.Context(), db, eventID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("update", current)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case update, open := <-updates:
+			if !open {
+				return false
+			}
+			c.SSEvent("update", update)
+			return true
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+			return true
+		}
+	})
+}
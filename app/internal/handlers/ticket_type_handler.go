@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"homework/app/internal/broker"
+	"homework/app/internal/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const ticketTypeColumns = "id, event_id, name, price, currency, quantity, sold, sales_start, sales_end, min_per_order, max_per_order, created_at"
+
+var (
+	errTicketTypeRequired = errors.New("Ticket type is required for this event")
+	errTicketTypeNotFound = errors.New("Ticket type not found")
+	errTicketTypeOffSale  = errors.New("Ticket type is not on sale")
+	errTicketTypeTooSmall = errors.New("This ticket type has fewer tickets than ordered")
+	errOrderLimit         = errors.New("Quantity is outside the per-order limits of this ticket type")
+)
+
+// ticketTypeFromPayload checks the settings of a ticket type that the
+// binding tags cannot express.
+func ticketTypeFromPayload(payload models.TicketTypePayload, eventID int) (models.TicketType, error) {
+	ticketType := models.TicketType{
+		EventID:     eventID,
+		Name:        payload.Name,
+		Price:       payload.Price,
+		Currency:    payload.Currency,
+		Quantity:    payload.Quantity,
+		SalesStart:  payload.SalesStart,
+		SalesEnd:    payload.SalesEnd,
+		MinPerOrder: max(payload.MinPerOrder, 1),
+		MaxPerOrder: payload.MaxPerOrder,
+	}
+	if ticketType.SalesStart != nil && ticketType.SalesEnd != nil && !ticketType.SalesEnd.After(*ticketType.SalesStart) {
+		return ticketType, errors.New("sales_end must be after sales_start")
+	}
+	if ticketType.MaxPerOrder != nil && *ticketType.MaxPerOrder < ticketType.MinPerOrder {
+		return ticketType, errors.New("max_per_order must not be less than min_per_order")
+	}
+	return ticketType, nil
+}
+
+func HandleCreateTicketType(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	var payload models.TicketTypePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	ticketType, err := ticketTypeFromPayload(payload, eventID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `INSERT INTO ticket_types (event_id, name, price, currency, quantity, sales_start, sales_end, min_per_order, max_per_order)
+		VALUES (:event_id, :name, :price, :currency, :quantity, :sales_start, :sales_end, :min_per_order, :max_per_order)
+		RETURNING id, created_at`
+	rows, err := db.NamedQuery(query, ticketType)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+		c.JSON(http.StatusConflict, gin.H{"error": "A ticket type with this name already exists"})
+		return
+	} else if err != nil {
+		log.Printf("Error creating ticket type: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket type"})
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(&ticketType.ID, &ticketType.CreatedAt); err != nil {
+			log.Printf("Error scanning ticket type: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket type"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, ticketType)
+}
+
+func HandleListTicketTypes(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventAccess(c, db, eventID, userID); !ok {
+		return
+	}
+
+	ticketTypes := []models.TicketType{}
+	query := "SELECT " + ticketTypeColumns + " FROM ticket_types WHERE event_id = $1 ORDER BY price, id"
+	if err := db.Select(&ticketTypes, query, eventID); err != nil {
+		log.Printf("Error fetching ticket types: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ticket types"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ticketTypes)
+}
+
+func HandleUpdateTicketType(c *gin.Context, db *sqlx.DB, hub broker.Broker) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	ticketTypeID, ok := idParam(c, "ticket_type_id")
+	if !ok {
+		return
+	}
+
+	var payload models.TicketTypePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	ticketType, err := ticketTypeFromPayload(payload, eventID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ticketType.ID = ticketTypeID
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, ok := requireEventOrganizer(c, tx, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+	// Registrations change sold counts under the event lock.
+	if _, err := tx.Exec("SELECT id FROM events WHERE id = $1 FOR UPDATE", eventID); err != nil {
+		log.Printf("Error locking event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket type"})
+		return
+	}
+
+	var sold int
+	query := "SELECT sold FROM ticket_types WHERE id = $1 AND event_id = $2"
+	if err := tx.Get(&sold, query, ticketTypeID, eventID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket type not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching ticket type: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket type"})
+		return
+	}
+	if ticketType.Quantity < sold {
+		c.JSON(http.StatusConflict, gin.H{"error": "Quantity cannot be lower than the tickets already sold", "sold": sold})
+		return
+	}
+
+	query = `UPDATE ticket_types SET name = :name, price = :price, currency = :currency, quantity = :quantity,
+			sales_start = :sales_start, sales_end = :sales_end, min_per_order = :min_per_order, max_per_order = :max_per_order
+		WHERE id = :id
+		RETURNING ` + ticketTypeColumns
+	query, args, err := tx.BindNamed(query, ticketType)
+	if err != nil {
+		log.Printf("Error binding ticket type: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket type"})
+		return
+	}
+	if err := tx.Get(&ticketType, query, args...); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			c.JSON(http.StatusConflict, gin.H{"error": "A ticket type with this name already exists"})
+			return
+		}
+		log.Printf("Error updating ticket type: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket type"})
+		return
+	}
+
+	// More tickets of this type may admit someone from the waitlist.
+	if err := promoteWaitlisted(c.Request.Context(), tx, eventID); err != nil {
+		log.Printf("Error promoting waitlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket type"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	publishEventState(c.Request.Context(), db, hub, eventID)
+
+	c.JSON(http.StatusOK, ticketType)
+}
+
+func HandleDeleteTicketType(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	eventID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	ticketTypeID, ok := idParam(c, "ticket_type_id")
+	if !ok {
+		return
+	}
+	if _, ok := requireEventOrganizer(c, db, eventID, userID, models.OrganizerEditor); !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM ticket_types WHERE id = $1 AND event_id = $2", ticketTypeID, eventID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ticket type has registrations and cannot be deleted"})
+		return
+	} else if err != nil {
+		log.Printf("Error deleting ticket type: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ticket type"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket type not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ticket type deleted"})
+}
+
+// reserveTicketType picks the ticket type a registration of quantity seats
+// uses and checks it can be sold now. It returns nil for events without
+// ticket types. Whether enough are left is up to seatStatus. The caller
+// must hold the event row lock, under which sold counts change.
+func reserveTicketType(ctx context.Context, tx *sqlx.Tx, eventID int, ticketTypeID *int, quantity int) (*models.TicketType, error) {
+	if ticketTypeID == nil {
+		var hasTypes bool
+		query := "SELECT EXISTS (SELECT 1 FROM ticket_types WHERE event_id = $1)"
+		if err := tx.GetContext(ctx, &hasTypes, query, eventID); err != nil {
+			return nil, err
+		}
+		if hasTypes {
+			return nil, errTicketTypeRequired
+		}
+		return nil, nil
+	}
+
+	var ticketType models.TicketType
+	query := "SELECT " + ticketTypeColumns + " FROM ticket_types WHERE id = $1 AND event_id = $2 FOR UPDATE"
+	if err := tx.GetContext(ctx, &ticketType, query, *ticketTypeID, eventID); err == sql.ErrNoRows {
+		return nil, errTicketTypeNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if (ticketType.SalesStart != nil && now.Before(*ticketType.SalesStart)) || (ticketType.SalesEnd != nil && !now.Before(*ticketType.SalesEnd)) {
+		return nil, errTicketTypeOffSale
+	}
+	if quantity < ticketType.MinPerOrder || (ticketType.MaxPerOrder != nil && quantity > *ticketType.MaxPerOrder) {
+		return nil, errOrderLimit
+	}
+	if quantity > ticketType.Quantity {
+		// More than the type ever has could never leave the waitlist.
+		return nil, errTicketTypeTooSmall
+	}
+	return &ticketType, nil
+}
+
+// isOrderError reports whether err rejects the requested tickets or promo
+// code rather than being a failure.
+func isOrderError(err error) bool {
+	for _, target := range []error{errTicketTypeRequired, errTicketTypeNotFound, errTicketTypeOffSale, errTicketTypeTooSmall, errOrderLimit,
+		errPromoCodeInvalid, errPromoCodeUsedUp, errPromoCodeUserLimit} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmSeats counts the seats of a registration that now occupies them,
+// confirmed or held for payment, against the event and its ticket type. The
+// caller must hold the event row lock.
+func confirmSeats(ctx context.Context, tx *sqlx.Tx, registration models.Registration) error {
+	query := "UPDATE events SET participant_count = participant_count + $1 WHERE id = $2"
+	if _, err := tx.ExecContext(ctx, query, registration.Quantity, registration.EventID); err != nil {
+		return err
+	}
+	if registration.TicketTypeID == nil {
+		return nil
+	}
+	query = "UPDATE ticket_types SET sold = sold + $1 WHERE id = $2"
+	_, err := tx.ExecContext(ctx, query, registration.Quantity, *registration.TicketTypeID)
+	return err
+}
+
+// releaseSeats undoes confirmSeats when a registration gives up its seats.
+// The caller must hold the event row lock.
+func releaseSeats(ctx context.Context, tx *sqlx.Tx, registration models.Registration) error {
+	query := "UPDATE events SET participant_count = participant_count - $1 WHERE id = $2"
+	if _, err := tx.ExecContext(ctx, query, registration.Quantity, registration.EventID); err != nil {
+		return err
+	}
+	if registration.TicketTypeID == nil {
+		return nil
+	}
+	query = "UPDATE ticket_types SET sold = sold - $1 WHERE id = $2"
+	_, err := tx.ExecContext(ctx, query, registration.Quantity, *registration.TicketTypeID)
+	return err
+}
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"homework/app/internal/models"
+	"homework/app/internal/notifications"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const transferQuery = `SELECT t.id, t.registration_id, r.event_id, e.name AS event_name, t.from_user_id, t.to_user_id, t.to_email,
+		t.status, t.created_at, t.resolved_at
+	FROM registration_transfers t
+	JOIN registrations r ON r.id = t.registration_id
+	JOIN events e ON e.id = r.event_id`
+
+// transferRecipient matches transfers addressed to user $2, by account or,
+// for transfers to an email without an account at the time, by email.
+const transferRecipient = `(t.to_user_id = $2 OR (t.to_user_id IS NULL AND t.to_email = (SELECT email FROM users WHERE id = $2)))`
+
+// HandleCreateTransfer offers the caller's confirmed registration to another
+// user. It changes hands only once the recipient accepts.
+func HandleCreateTransfer(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var payload models.CreateTransferPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	registration, ok := ownRegistration(c, tx, registrationID, userID, true)
+	if !ok {
+		return
+	}
+	var event models.Event
+	query := "SELECT id, name, status, transfers_enabled FROM events WHERE id = $1"
+	if err := tx.Get(&event, query, registration.EventID); err != nil {
+		log.Printf("Error fetching event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transfer"})
+		return
+	}
+	if !transferable(c, event, registration) {
+		return
+	}
+
+	transfer := models.Transfer{RegistrationID: registration.ID, EventID: event.ID, EventName: event.Name, FromUserID: userID, Status: models.TransferPending}
+	to := strings.TrimSpace(payload.To)
+	var recipient struct {
+		ID    int    `db:"id"`
+		Email string `db:"email"`
+	}
+	if strings.Contains(to, "@") {
+		err = tx.Get(&recipient, "SELECT id, email FROM users WHERE email = $1", to)
+		transfer.ToEmail = &to
+	} else {
+		err = tx.Get(&recipient, "SELECT id, email FROM users WHERE username = $1", to)
+	}
+	switch {
+	case err == sql.ErrNoRows && transfer.ToEmail == nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	case err == sql.ErrNoRows:
+		// The email may sign up later and accept then.
+	case err != nil:
+		log.Printf("Error fetching recipient: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transfer"})
+		return
+	case recipient.ID == userID:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot transfer a registration to yourself"})
+		return
+	default:
+		transfer.ToUserID = &recipient.ID
+		transfer.ToEmail = &recipient.Email
+	}
+
+	query = `INSERT INTO registration_transfers (registration_id, from_user_id, to_user_id, to_email)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err = tx.QueryRowx(query, transfer.RegistrationID, transfer.FromUserID, transfer.ToUserID, transfer.ToEmail).Scan(&transfer.ID, &transfer.CreatedAt)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+		c.JSON(http.StatusConflict, gin.H{"error": "A transfer of this registration is already pending"})
+		return
+	} else if err != nil {
+		log.Printf("Error creating transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transfer"})
+		return
+	}
+
+	if transfer.ToUserID != nil {
+		if err := notifications.Notify(c.Request.Context(), tx, *transfer.ToUserID, notifications.KindTransferOffered,
+			"A registration for "+event.Name+" was offered to you", "Accept the transfer to take over the ticket.", event.ID); err != nil {
+			log.Printf("Error notifying recipient: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transfer"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// transferable reports whether registration may change hands now. If not it
+// writes the error response.
+func transferable(c *gin.Context, event models.Event, registration models.Registration) bool {
+	switch {
+	case !event.TransfersEnabled:
+		c.JSON(http.StatusConflict, gin.H{"error": "The organizer has disabled transfers for this event"})
+	case event.Status != models.EventPublished:
+		c.JSON(http.StatusConflict, gin.H{"error": "Event is " + event.Status, "status": event.Status})
+	case registration.Status != models.RegistrationConfirmed:
+		c.JSON(http.StatusConflict, gin.H{"error": "Only confirmed registrations can be transferred", "status": registration.Status})
+	case registration.CheckedInAt != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration has already been checked in"})
+	default:
+		return true
+	}
+	return false
+}
+
+// HandleListTransfers returns the caller's pending transfers, both those
+// offered to them and those they offered.
+func HandleListTransfers(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	incoming := []models.Transfer{}
+	query := transferQuery + " WHERE t.status = $1 AND " + transferRecipient + " ORDER BY t.id"
+	if err := db.Select(&incoming, query, models.TransferPending, userID); err != nil {
+		log.Printf("Error fetching transfers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers"})
+		return
+	}
+
+	outgoing := []models.Transfer{}
+	query = transferQuery + " WHERE t.status = $1 AND t.from_user_id = $2 ORDER BY t.id"
+	if err := db.Select(&outgoing, query, models.TransferPending, userID); err != nil {
+		log.Printf("Error fetching transfers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"incoming": incoming, "outgoing": outgoing})
+}
+
+// HandleRegistrationTransfers returns the transfer history of a
+// registration to its current holder or the event's owners and editors.
+func HandleRegistrationTransfers(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	registrationID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var parties struct {
+		ParticipantID int  `db:"participant_id"`
+		Organizer     bool `db:"organizer"`
+	}
+	query := `SELECT r.participant_id, EXISTS (SELECT 1 FROM event_organizers o WHERE o.event_id = r.event_id AND o.user_id = $2 AND o.role IN ('owner', 'editor')) AS organizer
+		FROM registrations r WHERE r.id = $1`
+	err := db.Get(&parties, query, registrationID, userID)
+	if err == sql.ErrNoRows || (err == nil && userID != parties.ParticipantID && !parties.Organizer) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers"})
+		return
+	}
+
+	transfers := []models.Transfer{}
+	query = transferQuery + " WHERE t.registration_id = $1 ORDER BY t.id"
+	if err := db.Select(&transfers, query, registrationID); err != nil {
+		log.Printf("Error fetching transfers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+// HandleAcceptTransfer hands the registration to the caller and reissues
+// its ticket, revoking the code the previous holder had. Recipients of a
+// seat at a private event must be admitted to it like registrants, with the
+// code of an invite link in the "invite" query parameter if they were not
+// invited by email.
+func HandleAcceptTransfer(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	transferID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var transfer models.Transfer
+	query := transferQuery + " WHERE t.id = $1 AND t.status = 'pending' AND " + transferRecipient
+	if err := db.Get(&transfer, query, transferID, userID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The event lock serialises this with registrations, so the recipient
+	// cannot end up holding two registrations for the event.
+	var event models.Event
+	query = "SELECT id, name, created_by, status, transfers_enabled, visibility FROM events WHERE id = $1 FOR UPDATE"
+	if err := tx.Get(&event, query, transfer.EventID); err != nil {
+		log.Printf("Error fetching event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+	var status string
+	query = "SELECT status FROM registration_transfers WHERE id = $1 FOR UPDATE"
+	if err := tx.Get(&status, query, transfer.ID); err != nil {
+		log.Printf("Error fetching transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+	if status != models.TransferPending {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	}
+	var registration models.Registration
+	query = "SELECT id, event_id, participant_id, status, checked_in_at FROM registrations WHERE id = $1 FOR UPDATE"
+	if err := tx.Get(&registration, query, transfer.RegistrationID); err != nil {
+		log.Printf("Error fetching registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+	if registration.ParticipantID != transfer.FromUserID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Registration has changed hands since the transfer was offered"})
+		return
+	}
+	if !transferable(c, event, registration) {
+		return
+	}
+
+	var holds bool
+	query = "SELECT EXISTS (SELECT 1 FROM registrations WHERE event_id = $1 AND participant_id = $2 AND status NOT IN ('cancelled', 'expired', 'rejected'))"
+	if err := tx.Get(&holds, query, event.ID, userID); err != nil {
+		log.Printf("Error checking registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+	if holds {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already registered for this event"})
+		return
+	}
+	if event.Visibility == models.VisibilityPrivate {
+		invite := c.Query("invite")
+		admitted, err := admitToPrivateEvent(c.Request.Context(), tx, event, userID, invite)
+		if err != nil {
+			log.Printf("Error checking invite: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+			return
+		}
+		if !admitted && invite != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invite is invalid, expired or used up"})
+			return
+		} else if !admitted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This event is private; you need an invite to accept the transfer"})
+			return
+		}
+	}
+
+	query = "UPDATE registrations SET participant_id = $1, ticket_nonce = md5(random()::text || clock_timestamp()::text) WHERE id = $2"
+	if _, err := tx.Exec(query, userID, registration.ID); err != nil {
+		log.Printf("Error transferring registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+	if err := resolveTransfer(c.Request.Context(), tx, &transfer, models.TransferAccepted, userID); err != nil {
+		log.Printf("Error resolving transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+	if err := notifications.Notify(c.Request.Context(), tx, transfer.FromUserID, notifications.KindTransferAccepted,
+		"Your registration for "+event.Name+" was transferred", "The recipient accepted the transfer; your ticket is no longer valid.", event.ID); err != nil {
+		log.Printf("Error notifying sender: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer accepted", "registration_id": registration.ID, "transfer": transfer})
+}
+
+// HandleDeclineTransfer turns down a transfer offered to the caller.
+func HandleDeclineTransfer(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	transferID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var transfer models.Transfer
+	query := transferQuery + " WHERE t.id = $1 AND t.status = 'pending' AND " + transferRecipient + " FOR UPDATE OF t"
+	if err := tx.Get(&transfer, query, transferID, userID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline transfer"})
+		return
+	}
+	if err := resolveTransfer(c.Request.Context(), tx, &transfer, models.TransferDeclined, userID); err != nil {
+		log.Printf("Error resolving transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline transfer"})
+		return
+	}
+	if err := notifications.Notify(c.Request.Context(), tx, transfer.FromUserID, notifications.KindTransferDeclined,
+		"Your transfer for "+transfer.EventName+" was declined", "You still hold the registration.", transfer.EventID); err != nil {
+		log.Printf("Error notifying sender: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline transfer"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// HandleCancelTransfer withdraws a transfer the caller offered.
+func HandleCancelTransfer(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	transferID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var transfer models.Transfer
+	query := transferQuery + " WHERE t.id = $1 AND t.status = 'pending' AND t.from_user_id = $2 FOR UPDATE OF t"
+	if err := tx.Get(&transfer, query, transferID, userID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel transfer"})
+		return
+	}
+	if err := resolveTransfer(c.Request.Context(), tx, &transfer, models.TransferCancelled, 0); err != nil {
+		log.Printf("Error resolving transfer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel transfer"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// resolveTransfer closes a pending transfer with status. A recipient who
+// answers a transfer sent to their email is recorded as its recipient.
+func resolveTransfer(ctx context.Context, tx *sqlx.Tx, transfer *models.Transfer, status string, recipientID int) error {
+	query := `UPDATE registration_transfers SET status = $1, resolved_at = now(), to_user_id = COALESCE(to_user_id, NULLIF($2, 0))
+		WHERE id = $3
+		RETURNING status, to_user_id, resolved_at`
+	return tx.QueryRowxContext(ctx, query, status, recipientID, transfer.ID).Scan(&transfer.Status, &transfer.ToUserID, &transfer.ResolvedAt)
+}
+
+// cancelPendingTransfers withdraws any transfer offered for a registration
+// that is giving up its seats.
+func cancelPendingTransfers(ctx context.Context, tx *sqlx.Tx, registrationID int) error {
+	query := "UPDATE registration_transfers SET status = 'cancelled', resolved_at = now() WHERE registration_id = $1 AND status = 'pending'"
+	_, err := tx.ExecContext(ctx, query, registrationID)
+	return err
+}
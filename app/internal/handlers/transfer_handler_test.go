@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"homework/app/internal/broker"
+	"homework/app/internal/invites"
+	"homework/app/internal/models"
+	"homework/app/internal/payments"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTransferToPrivateEventNeedsAnInvite(t *testing.T) {
+	db := testDB(t)
+	owner := createUser(t, db, "owner")
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	event := createEvent(t, db, owner, intPtr(10))
+	registration := int(registerFor(t, db, broker.NewLocal(), "alice", event.ID)["registration_id"].(float64))
+	if _, err := db.Exec("UPDATE events SET visibility = $1 WHERE id = $2", models.VisibilityPrivate, event.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	offer := func(c *gin.Context) { HandleCreateTransfer(c, db) }
+	path := "/registrations/" + strconv.Itoa(registration) + "/transfer"
+	w := perform(t, offer, "alice", http.MethodPost, "/registrations/:id/transfer", path, gin.H{"to": "bob"})
+	expectStatus(t, w, http.StatusCreated)
+	transferID := int(decode(t, w.Body.Bytes())["id"].(float64))
+
+	accept := func(c *gin.Context) { HandleAcceptTransfer(c, db) }
+	acceptPath := "/transfers/" + strconv.Itoa(transferID) + "/accept"
+	expectStatus(t, perform(t, accept, "bob", http.MethodPost, "/transfers/:id/accept", acceptPath, nil), http.StatusForbidden)
+	expectStatus(t, perform(t, accept, "bob", http.MethodPost, "/transfers/:id/accept", acceptPath+"?invite=forged", nil), http.StatusForbidden)
+	if got := registrationStatus(t, db, event.ID, alice); got != models.RegistrationConfirmed {
+		t.Fatalf("alice after refused transfer: %s, want still confirmed", got)
+	}
+
+	invite := func(c *gin.Context) { HandleCreateInvites(c, db) }
+	invitePath := "/events/" + strconv.Itoa(event.ID) + "/invites"
+	w = perform(t, invite, "owner", http.MethodPost, "/events/:id/invites", invitePath, gin.H{"emails": []string{"bob@example.com"}})
+	expectStatus(t, w, http.StatusCreated)
+
+	// Having the invited address is not enough; the mailed code is needed.
+	expectStatus(t, perform(t, accept, "bob", http.MethodPost, "/transfers/:id/accept", acceptPath, nil), http.StatusForbidden)
+	var mailed models.Invite
+	if err := db.Get(&mailed, "SELECT "+inviteColumns+" FROM event_invites WHERE event_id = $1", event.ID); err != nil {
+		t.Fatal(err)
+	}
+	code := invites.Code(invites.Invite{Email: true, ID: mailed.ID, EventID: event.ID, Nonce: mailed.Nonce})
+	expectStatus(t, perform(t, accept, "bob", http.MethodPost, "/transfers/:id/accept", acceptPath+"?invite="+url.QueryEscape(code), nil), http.StatusOK)
+	if got := registrationStatus(t, db, event.ID, bob); got != models.RegistrationConfirmed {
+		t.Fatalf("bob after accepting: %s, want confirmed", got)
+	}
+
+	// The redeemed code admits nobody else.
+	createUser(t, db, "mallory")
+	register := func(c *gin.Context) {
+		HandleRegistrationEvent(c, db, broker.NewLocal(), payments.NewFake([]byte("test-secret"), "http://localhost"))
+	}
+	w = perform(t, register, "mallory", http.MethodPost, "/register-event", "/register-event", gin.H{"event_id": event.ID, "invite": code})
+	expectStatus(t, w, http.StatusForbidden)
+}
@@ -101,7 +101,7 @@ func HandleUserLogin(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
-	c.SetCookie("token", tokenString, 3600, "/", "localhost", false, true)
+	utils.SetAuthCookie(c, tokenString)
 	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": tokenString})
 }
 
@@ -145,7 +145,7 @@ func HandleChangeUsername(c *gin.Context, db *sqlx.DB) {
 		return
 	}
 
-	c.SetCookie("token", tokenString, 3600, "/", "localhost", false, true)
+	utils.SetAuthCookie(c, tokenString)
 	c.JSON(http.StatusOK, gin.H{"message": "Username changed successfully", "new_username": payload.NewUsername})
 }
 
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"homework/app/internal/models"
+	"homework/app/internal/webhooks"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func HandleCreateWebhook(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	var payload models.CreateWebhookPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if err := webhooks.ValidateURL(c.Request.Context(), payload.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook URL", "details": err.Error()})
+		return
+	}
+	for _, eventType := range payload.EventTypes {
+		if !webhooks.IsEventType(eventType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type", "event_type": eventType, "supported": webhooks.EventTypes})
+			return
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+		return
+	}
+
+	hook := models.Webhook{
+		OwnerID:    userID,
+		URL:        payload.URL,
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: pq.StringArray(payload.EventTypes),
+	}
+	if hook.EventTypes == nil {
+		hook.EventTypes = pq.StringArray{}
+	}
+
+	query := "INSERT INTO webhooks (owner_id, url, secret, event_types) VALUES ($1, $2, $3, $4) RETURNING id, active, created_at"
+	if err := db.QueryRowx(query, hook.OwnerID, hook.URL, hook.Secret, hook.EventTypes).Scan(&hook.ID, &hook.Active, &hook.CreatedAt); err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	// The secret is only ever shown once, at creation.
+	c.JSON(http.StatusCreated, gin.H{"webhook": hook, "secret": hook.Secret})
+}
+
+func HandleListWebhooks(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+
+	hooks := []models.Webhook{}
+	query := "SELECT * FROM webhooks WHERE owner_id = $1 ORDER BY id"
+	if err := db.Select(&hooks, query, userID); err != nil {
+		log.Printf("Error fetching webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": hooks})
+}
+
+func HandleDeleteWebhook(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	hookID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM webhooks WHERE id = $1 AND owner_id = $2", hookID, userID)
+	if err != nil {
+		log.Printf("Error deleting webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+func HandleListWebhookDeliveries(c *gin.Context, db *sqlx.DB) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	hookID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if !ownsWebhook(c, db, hookID, userID) {
+		return
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	query := "SELECT * FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT 100"
+	if err := db.Select(&deliveries, query, hookID); err != nil {
+		log.Printf("Error fetching webhook deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func HandleRedeliverWebhook(c *gin.Context, db *sqlx.DB, dispatcher *webhooks.Dispatcher) {
+	userID, ok := currentUserID(c, db)
+	if !ok {
+		return
+	}
+	hookID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := idParam(c, "delivery_id")
+	if !ok {
+		return
+	}
+	if !ownsWebhook(c, db, hookID, userID) {
+		return
+	}
+
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2)"
+	if err := db.Get(&exists, query, deliveryID, hookID); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+
+	newID, err := dispatcher.Redeliver(c.Request.Context(), deliveryID)
+	if err != nil {
+		log.Printf("Error queueing redelivery: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue redelivery"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Redelivery queued", "delivery_id": newID})
+}
+
+func ownsWebhook(c *gin.Context, db *sqlx.DB, hookID, userID int) bool {
+	var ownerID int
+	err := db.Get(&ownerID, "SELECT owner_id FROM webhooks WHERE id = $1", hookID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return false
+	}
+	if err != nil {
+		log.Printf("Error fetching webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook"})
+		return false
+	}
+	return true
+}
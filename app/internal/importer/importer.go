@@ -0,0 +1,259 @@
+// Package importer reads events from CSV and iCalendar files into
+// CreateEventPayloads, leaving validation to the caller so imported events
+// pass the same rules as events created one at a time.
+//
+// CSV files need a header row. Columns are matched by name, case-insensitively:
+//
+//	name         required  event name
+//	description  required  free text
+//	location     required  free text
+//	start_time   required  HH:MM, 24-hour
+//	end_time     required  HH:MM, 24-hour
+//	date         required  DD-MM-YY
+//	capacity     optional  positive integer, empty for unlimited
+//
+// iCalendar files contribute one event per VEVENT: SUMMARY becomes the name,
+// DESCRIPTION and LOCATION are copied, and DTSTART/DTEND provide the date and
+// times. Times are taken as written; a trailing Z or TZID is not converted.
+// Recurring VEVENTs, those with an RRULE or RDATE, are reported as errors
+// rather than imported as their first occurrence; create a series for them.
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"homework/app/internal/models"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV = "csv"
+	FormatICS = "ics"
+
+	// MaxRows bounds a single import.
+	MaxRows = 1000
+)
+
+// Row is one event read from a file. Line is the CSV line or the position of
+// the VEVENT. Err is set when the row could not be read at all.
+type Row struct {
+	Line    int
+	Payload models.CreateEventPayload
+	Err     error
+}
+
+func Parse(format string, r io.Reader) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatICS:
+		return parseICS(r)
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+var csvColumns = []string{"name", "description", "location", "start_time", "end_time", "date", "capacity"}
+
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+	for _, column := range csvColumns[:6] {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, Row{Line: parseErr.Line, Err: parseErr.Err})
+			continue
+		}
+		if len(rows) == MaxRows {
+			return nil, fmt.Errorf("file has more than %d rows", MaxRows)
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			if i, ok := index[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := Row{Line: line, Payload: models.CreateEventPayload{
+			Name:        field("name"),
+			Description: field("description"),
+			Location:    field("location"),
+			StartTime:   field("start_time"),
+			EndTime:     field("end_time"),
+			Date:        field("date"),
+		}}
+		if capacity := field("capacity"); capacity != "" {
+			n, err := strconv.Atoi(capacity)
+			if err != nil {
+				row.Err = fmt.Errorf("capacity %q is not a number", capacity)
+			}
+			row.Payload.Capacity = &n
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseICS reads VEVENTs from an iCalendar stream. It understands folded
+// lines, property parameters and the escapes defined by RFC 5545.
+func parseICS(r io.Reader) ([]Row, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	var current map[string]icsProperty
+	for _, line := range lines {
+		name, prop := parseProperty(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			current = make(map[string]icsProperty)
+		case name == "END" && strings.EqualFold(prop.value, "VEVENT") && current != nil:
+			if len(rows) == MaxRows {
+				return nil, fmt.Errorf("file has more than %d events", MaxRows)
+			}
+			rows = append(rows, eventRow(len(rows)+1, current))
+			current = nil
+		case current != nil:
+			if _, seen := current[name]; !seen {
+				current[name] = prop
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("file contains no VEVENT")
+	}
+	return rows, nil
+}
+
+type icsProperty struct {
+	params map[string]string
+	value  string
+}
+
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func parseProperty(line string) (string, icsProperty) {
+	prop := icsProperty{params: make(map[string]string)}
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return strings.ToUpper(line), prop
+	}
+	prop.value = line[colon+1:]
+
+	parts := strings.Split(line[:colon], ";")
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			prop.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), prop
+}
+
+var errRecurring = errors.New("recurring events are not supported, create them as a series")
+
+var icsEscapes = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func eventRow(n int, props map[string]icsProperty) Row {
+	row := Row{Line: n, Payload: models.CreateEventPayload{
+		Name:        icsEscapes.Replace(props["SUMMARY"].value),
+		Description: icsEscapes.Replace(props["DESCRIPTION"].value),
+		Location:    icsEscapes.Replace(props["LOCATION"].value),
+	}}
+	if _, ok := props["RRULE"]; ok {
+		row.Err = errRecurring
+		return row
+	}
+	if _, ok := props["RDATE"]; ok {
+		row.Err = errRecurring
+		return row
+	}
+
+	start, allDay, err := parseICSTime(props["DTSTART"])
+	if err != nil {
+		row.Err = fmt.Errorf("DTSTART: %w", err)
+		return row
+	}
+	end := start
+	if allDay {
+		end = start.Add(23*time.Hour + 59*time.Minute)
+	}
+	if prop, ok := props["DTEND"]; ok && !allDay {
+		if end, _, err = parseICSTime(prop); err != nil {
+			row.Err = fmt.Errorf("DTEND: %w", err)
+			return row
+		}
+	}
+	if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+		row.Err = errors.New("events spanning several days are not supported")
+		return row
+	}
+
+	row.Payload.Date = start.Format(models.DateFormat)
+	row.Payload.StartTime = start.Format(models.TimeFormat)
+	row.Payload.EndTime = end.Format(models.TimeFormat)
+	return row
+}
+
+func parseICSTime(prop icsProperty) (time.Time, bool, error) {
+	value := strings.TrimSuffix(prop.value, "Z")
+	if value == "" {
+		return time.Time{}, false, errors.New("missing")
+	}
+	if prop.params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.Parse("20060102", value)
+		return t, true, err
+	}
+	t, err := time.Parse("20060102T150405", value)
+	return t, false, err
+}
@@ -0,0 +1,158 @@
+package importer
+
+import (
+	"homework/app/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	meetup := models.CreateEventPayload{
+		Name: "Meetup", Description: "Talks", Location: "Hall",
+		StartTime: "18:00", EndTime: "20:00", Date: "24-10-26",
+	}
+	withCapacity := meetup
+	withCapacity.Capacity = new(int)
+	*withCapacity.Capacity = 50
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []models.CreateEventPayload
+		wantErr []string
+	}{
+		{
+			name:   "csv",
+			format: FormatCSV,
+			input:  "Name,Description,Location,Start_Time,End_Time,Date,Capacity\nMeetup,Talks,Hall,18:00,20:00,24-10-26,50\n",
+			want:   []models.CreateEventPayload{withCapacity},
+		},
+		{
+			name:   "csv with reordered columns, a byte order mark and no capacity",
+			format: FormatCSV,
+			input:  "\ufeffdate,name,description,location,start_time,end_time\n24-10-26,Meetup,Talks,Hall,18:00,20:00\n",
+			want:   []models.CreateEventPayload{meetup},
+		},
+		{
+			name:    "csv with a bad capacity",
+			format:  FormatCSV,
+			input:   "name,description,location,start_time,end_time,date,capacity\nMeetup,Talks,Hall,18:00,20:00,24-10-26,lots\n",
+			want:    []models.CreateEventPayload{withCapacity},
+			wantErr: []string{`capacity "lots" is not a number`},
+		},
+		{
+			name:    "csv missing a column",
+			format:  FormatCSV,
+			input:   "name,description,location,start_time,end_time\nMeetup,Talks,Hall,18:00,20:00\n",
+			wantErr: []string{`missing column "date"`},
+		},
+		{
+			name:    "empty csv",
+			format:  FormatCSV,
+			wantErr: []string{"file is empty"},
+		},
+		{
+			name:   "ics",
+			format: FormatICS,
+			input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Meetup\r\nDESCRIPTION:Ta\r\n lks\r\n" +
+				"LOCATION:Hall\r\nDTSTART;TZID=Europe/Paris:20261024T180000\r\nDTEND:20261024T200000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			want: []models.CreateEventPayload{meetup},
+		},
+		{
+			name:   "ics with escapes and an all-day event",
+			format: FormatICS,
+			input: "BEGIN:VEVENT\nSUMMARY:Fair\\, day one\nDESCRIPTION:Stalls\\nand food\nLOCATION:Park\n" +
+				"DTSTART;VALUE=DATE:20261024\nEND:VEVENT\n",
+			want: []models.CreateEventPayload{{
+				Name: "Fair, day one", Description: "Stalls\nand food", Location: "Park",
+				StartTime: "00:00", EndTime: "23:59", Date: "24-10-26",
+			}},
+		},
+		{
+			name:   "ics with bad and recurring events",
+			format: FormatICS,
+			input: "BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT\n" +
+				"BEGIN:VEVENT\nSUMMARY:Weekly\nDTSTART:20261024T180000\nRRULE:FREQ=WEEKLY\nEND:VEVENT\n" +
+				"BEGIN:VEVENT\nSUMMARY:Twice\nDTSTART:20261024T180000\nRDATE:20261031T180000\nEND:VEVENT\n" +
+				"BEGIN:VEVENT\nSUMMARY:Overnight\nDTSTART:20261024T220000\nDTEND:20261025T020000\nEND:VEVENT\n",
+			want: []models.CreateEventPayload{{Name: "No start"}, {Name: "Weekly"}, {Name: "Twice"}, {Name: "Overnight"}},
+			wantErr: []string{
+				"DTSTART: missing",
+				errRecurring.Error(),
+				errRecurring.Error(),
+				"events spanning several days are not supported",
+			},
+		},
+		{
+			name:    "ics without events",
+			format:  FormatICS,
+			input:   "BEGIN:VCALENDAR\nEND:VCALENDAR\n",
+			wantErr: []string{"file contains no VEVENT"},
+		},
+		{
+			name:    "unknown format",
+			format:  "xlsx",
+			wantErr: []string{`unsupported import format "xlsx"`},
+		},
+	}
+	for _, tt := range tests {
+		rows, err := Parse(tt.format, strings.NewReader(tt.input))
+		if tt.want == nil {
+			if err == nil || err.Error() != tt.wantErr[0] {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr[0])
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(rows) != len(tt.want) {
+			t.Errorf("%s: %d rows, want %d", tt.name, len(rows), len(tt.want))
+			continue
+		}
+		for i, row := range rows {
+			wantErr := ""
+			if tt.wantErr != nil {
+				wantErr = tt.wantErr[i]
+			}
+			if gotErr := errString(row.Err); gotErr != wantErr {
+				t.Errorf("%s: row %d error = %q, want %q", tt.name, i+1, gotErr, wantErr)
+			}
+			if wantErr != "" {
+				// Rows that fail keep what was read, for reporting.
+				if row.Payload.Name != tt.want[i].Name {
+					t.Errorf("%s: row %d name = %q, want %q", tt.name, i+1, row.Payload.Name, tt.want[i].Name)
+				}
+				continue
+			}
+			if !samePayload(row.Payload, tt.want[i]) {
+				t.Errorf("%s: row %d = %+v, want %+v", tt.name, i+1, row.Payload, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseCSVLimitsRows(t *testing.T) {
+	input := "name,description,location,start_time,end_time,date\n" +
+		strings.Repeat("Meetup,Talks,Hall,18:00,20:00,24-10-26\n", MaxRows+1)
+	if _, err := Parse(FormatCSV, strings.NewReader(input)); err == nil {
+		t.Fatalf("parsed %d rows, want an error", MaxRows+1)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func samePayload(a, b models.CreateEventPayload) bool {
+	if (a.Capacity == nil) != (b.Capacity == nil) || (a.Capacity != nil && *a.Capacity != *b.Capacity) {
+		return false
+	}
+	a.Capacity, b.Capacity = nil, nil
+	return a == b
+}
@@ -0,0 +1,36 @@
+package invites
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCodeRoundTrips(t *testing.T) {
+	for _, invite := range []Invite{
+		{ID: 7, EventID: 42, Nonce: "abc"},
+		{Email: true, ID: 7, EventID: 42, Nonce: "abc"},
+	} {
+		got, err := Parse(" " + Code(invite) + " ")
+		if err != nil || got != invite {
+			t.Errorf("Parse(Code(%+v)) = %+v, %v", invite, got, err)
+		}
+	}
+}
+
+func TestParseRejectsTamperedCodes(t *testing.T) {
+	link := Code(Invite{ID: 7, EventID: 42, Nonce: "abc"})
+	email := Code(Invite{Email: true, ID: 7, EventID: 42, Nonce: "abc"})
+	for _, code := range []string{
+		"",
+		"garbage",
+		strings.Replace(link, ".42.", ".43.", 1),
+		strings.Replace(link, "I1.", "E1.", 1),
+		strings.Replace(email, "E1.", "I1.", 1),
+		link[:len(link)-1],
+		link + "x",
+	} {
+		if _, err := Parse(code); err != ErrInvalidCode {
+			t.Errorf("Parse(%q) = %v, want ErrInvalidCode", code, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package jobs is a transactional outbox and background job runner backed by
+// the jobs table.
+//
+// Side effects of a request are enqueued with Enqueue inside the same
+// transaction as the domain change, so they are recorded if and only if the
+// change commits. A Runner then claims due jobs with SELECT ... FOR UPDATE
+// SKIP LOCKED, which lets any number of replicas share the queue. Failed jobs
+// are retried with exponential backoff until they run out of attempts and are
+// dead-lettered with status "dead".
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"homework/app/internal/config"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+type Job struct {
+	ID          int            `db:"id"`
+	Kind        string         `db:"kind"`
+	Payload     types.JSONText `db:"payload"`
+	Status      string         `db:"status"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	RunAt       time.Time      `db:"run_at"`
+	LockedUntil *time.Time     `db:"locked_until"`
+	LastError   *string        `db:"last_error"`
+	CreatedAt   time.Time      `db:"created_at"`
+	FinishedAt  *time.Time     `db:"finished_at"`
+}
+
+// LastAttempt reports whether a failure of the current attempt will
+// dead-letter the job.
+func (j Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// Handler runs one job. Returning an error schedules a retry.
+type Handler func(ctx context.Context, job Job) error
+
+type Option func(*enqueueOptions)
+
+type enqueueOptions struct {
+	runAt       time.Time
+	maxAttempts int
+}
+
+// RunAt delays the job until t.
+func RunAt(t time.Time) Option {
+	return func(o *enqueueOptions) { o.runAt = t }
+}
+
+// MaxAttempts overrides the runner's default number of attempts.
+func MaxAttempts(n int) Option {
+	return func(o *enqueueOptions) { o.maxAttempts = n }
+}
+
+var defaultMaxAttempts = 10
+
+// finishTimeout bounds recording the outcome of a job.
+const finishTimeout = 10 * time.Second
+
+// Configure sets defaults used by Enqueue. It must be called once at startup.
+func Configure(cfg config.JobsConfig) {
+	defaultMaxAttempts = cfg.MaxAttempts
+}
+
+// Enqueue records a job. Pass the transaction that carries the domain change
+// as ext so the job commits or rolls back with it.
+func Enqueue(ctx context.Context, ext sqlx.ExtContext, kind string, payload any, opts ...Option) (int, error) {
+	o := enqueueOptions{maxAttempts: defaultMaxAttempts}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var runAt any
+	if !o.runAt.IsZero() {
+		runAt = o.runAt
+	}
+
+	var id int
+	query := "INSERT INTO jobs (kind, payload, max_attempts, run_at) VALUES ($1, $2, $3, COALESCE($4, now())) RETURNING id"
+	err = sqlx.GetContext(ctx, ext, &id, query, kind, body, o.maxAttempts, runAt)
+	return id, err
+}
+
+type Runner struct {
+	db       *sqlx.DB
+	cfg      config.JobsConfig
+	handlers map[string]Handler
+}
+
+func NewRunner(db *sqlx.DB, cfg config.JobsConfig) *Runner {
+	return &Runner{
+		db:       db,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler for kind. It must be called before Run.
+func (r *Runner) Register(kind string, handler Handler) {
+	r.handlers[kind] = handler
+}
+
+// Run starts the worker pool and blocks until ctx is cancelled and every
+// in-flight job has finished. Jobs keep running after cancellation for up to
+// the configured job timeout so that shutdown does not cut them off midway.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			ran, err := r.runOne(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Job runner: %v", err)
+				}
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOne claims and runs a single due job. It reports whether there was one.
+// Jobs stuck in "running" past their lease belonged to a crashed worker and
+// are claimed again.
+func (r *Runner) runOne(ctx context.Context) (bool, error) {
+	var job Job
+	query := `UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_until = now() + $1 * interval '1 second'
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = 'pending' AND run_at <= now()) OR (status = 'running' AND locked_until < now())
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`
+	err := r.db.GetContext(ctx, &job, query, r.cfg.JobTimeout.Seconds()*2)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.JobTimeout)
+	defer cancel()
+
+	runErr := r.execute(jobCtx, job)
+
+	// A job that ran out of time has used up jobCtx too, and its outcome
+	// must still be recorded.
+	finishCtx, cancelFinish := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancelFinish()
+	r.finish(finishCtx, job, runErr)
+	return true, nil
+}
+
+func (r *Runner) execute(ctx context.Context, job Job) (err error) {
+	handler, ok := r.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for job kind %q", job.Kind)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (r *Runner) finish(ctx context.Context, job Job, runErr error) {
+	var query string
+	var args []any
+	switch {
+	case runErr == nil:
+		query = "UPDATE jobs SET status = 'done', locked_until = NULL, last_error = NULL, finished_at = now() WHERE id = $1"
+		args = []any{job.ID}
+	case job.LastAttempt():
+		log.Printf("Job %d (%s) dead-lettered after %d attempts: %v", job.ID, job.Kind, job.Attempts, runErr)
+		query = "UPDATE jobs SET status = 'dead', locked_until = NULL, last_error = $1, finished_at = now() WHERE id = $2"
+		args = []any{runErr.Error(), job.ID}
+	default:
+		query = "UPDATE jobs SET status = 'pending', locked_until = NULL, last_error = $1, run_at = now() + $2 * interval '1 second' WHERE id = $3"
+		args = []any{runErr.Error(), r.backoff(job.Attempts).Seconds(), job.ID}
+	}
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		log.Printf("Failed to record outcome of job %d: %v", job.ID, err)
+	}
+}
+
+// backoff doubles the wait after every failed attempt, capped at MaxBackoff,
+// with up to 20% jitter so that retries do not line up.
+func (r *Runner) backoff(attempts int) time.Duration {
+	wait := r.cfg.InitialBackoff
+	for i := 1; i < attempts && wait < r.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, r.cfg.MaxBackoff)
+	return wait + time.Duration(rand.Int64N(int64(wait)/5+1))
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"homework/app/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// APIKey authenticates requests carrying an X-API-Key header as the key's
+// user, for Auth and OptionalAuth to accept, and records the key for rate
+// limits keyed by it. A key that is unknown or revoked is rejected rather
+// than ignored, so it never falls back to other credentials.
+func APIKey(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(apiKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		var owner struct {
+			KeyID    int    `db:"id"`
+			Username string `db:"username"`
+		}
+		query := `SELECT k.id, u.username FROM api_keys k JOIN users u ON u.id = k.user_id
+			WHERE k.key_hash = $1 AND k.revoked_at IS NULL`
+		err := db.GetContext(c.Request.Context(), &owner, query, utils.HashAPIKey(key))
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		} else if err != nil {
+			log.Printf("Error verifying API key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify API key"})
+			c.Abort()
+			return
+		}
+
+		c.Set("username", owner.Username)
+		c.Set("api_key_id", owner.KeyID)
+		c.Next()
+	}
+}
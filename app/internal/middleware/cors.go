@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"errors"
+	"homework/app/internal/config"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS builds a middleware that answers preflight requests and decorates
+// cross-origin responses according to cfg. Browsers refuse credentialed
+// responses with a wildcard origin, so that combination is rejected up front.
+func CORS(cfg config.CORSConfig) (gin.HandlerFunc, error) {
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	anyOrigin := false
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+			continue
+		}
+		origins[strings.TrimSuffix(strings.ToLower(origin), "/")] = true
+	}
+	if anyOrigin && cfg.AllowCredentials {
+		return nil, errors.New("cors: wildcard origin cannot be combined with credentials")
+	}
+
+	methods := make(map[string]bool, len(cfg.AllowedMethods))
+	for _, method := range cfg.AllowedMethods {
+		methods[strings.ToUpper(method)] = true
+	}
+	headers := make(map[string]bool, len(cfg.AllowedHeaders))
+	for _, header := range cfg.AllowedHeaders {
+		headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Add("Vary", "Origin")
+		allowed := anyOrigin || origins[strings.ToLower(origin)]
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			if !allowed || !methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			for _, header := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+				header = strings.TrimSpace(header)
+				if header != "" && !headers[http.CanonicalHeaderKey(header)] {
+					c.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+			}
+
+			setAllowOrigin(h, origin, anyOrigin, cfg.AllowCredentials)
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if allowed {
+			setAllowOrigin(h, origin, anyOrigin, cfg.AllowCredentials)
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+		}
+		c.Next()
+	}, nil
+}
+
+func setAllowOrigin(h http.Header, origin string, anyOrigin, credentials bool) {
+	if anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
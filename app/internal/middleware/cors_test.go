@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"homework/app/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handle runs req through handlers, ending in one that answers 200.
+func handle(req *http.Request, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	handlers = append(handlers, func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.Handle(req.Method, "/", handlers...)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORS(t *testing.T) {
+	cors, err := CORS(config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com/"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+		want    map[string]string
+	}{
+		{"same origin", http.MethodGet, nil, http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""}},
+		{"allowed origin", http.MethodGet, map[string]string{"Origin": "https://APP.example.com"}, http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "https://APP.example.com", "Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers": "Retry-After", "Vary": "Origin"}},
+		{"other origin", http.MethodPost, map[string]string{"Origin": "https://evil.example.com"}, http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"}},
+		{"preflight", http.MethodOptions, map[string]string{"Origin": "https://app.example.com",
+			"Access-Control-Request-Method": "post", "Access-Control-Request-Headers": "content-type, x-csrf-token"}, http.StatusNoContent,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-CSRF-Token", "Access-Control-Max-Age": "600"}},
+		{"preflight from other origin", http.MethodOptions, map[string]string{"Origin": "https://evil.example.com",
+			"Access-Control-Request-Method": "POST"}, http.StatusForbidden,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+		{"preflight for other method", http.MethodOptions, map[string]string{"Origin": "https://app.example.com",
+			"Access-Control-Request-Method": "DELETE"}, http.StatusForbidden,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+		{"preflight for other header", http.MethodOptions, map[string]string{"Origin": "https://app.example.com",
+			"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "Content-Type, X-Admin"}, http.StatusForbidden,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		w := handle(req, cors)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		for header, want := range tt.want {
+			if got := w.Header().Get(header); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, header, got, want)
+			}
+		}
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	if _, err := CORS(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}); err == nil {
+		t.Fatal("wildcard origin with credentials accepted")
+	}
+	cors, err := CORS(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	w := handle(req, cors)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"homework/app/internal/config"
+	"homework/app/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	utils.ConfigureCookies(config.CookieConfig{Name: "session", Path: "/", CSRFCookieName: "csrf", CSRFHeaderName: "X-CSRF-Token"})
+	session := &http.Cookie{Name: "session", Value: "token"}
+	csrf := &http.Cookie{Name: "csrf", Value: "secret"}
+
+	tests := []struct {
+		name    string
+		method  string
+		cookies []*http.Cookie
+		headers map[string]string
+		status  int
+	}{
+		{"safe method", http.MethodGet, []*http.Cookie{session}, nil, http.StatusOK},
+		{"no session cookie", http.MethodPost, nil, nil, http.StatusOK},
+		{"bearer token", http.MethodPost, []*http.Cookie{session}, map[string]string{"Authorization": "Bearer token"}, http.StatusOK},
+		{"api key", http.MethodPost, []*http.Cookie{session}, map[string]string{apiKeyHeader: "ak_key"}, http.StatusOK},
+		{"matching token", http.MethodPost, []*http.Cookie{session, csrf}, map[string]string{"X-CSRF-Token": "secret"}, http.StatusOK},
+		{"missing header", http.MethodPost, []*http.Cookie{session, csrf}, nil, http.StatusForbidden},
+		{"wrong header", http.MethodDelete, []*http.Cookie{session, csrf}, map[string]string{"X-CSRF-Token": "guess"}, http.StatusForbidden},
+		// A token cookie issued with this very response cannot vouch for it.
+		{"missing cookie", http.MethodPost, []*http.Cookie{session}, map[string]string{"X-CSRF-Token": "guess"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		for _, cookie := range tt.cookies {
+			req.AddCookie(cookie)
+		}
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		w := handle(req, CSRF)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestCSRFIssuesToken(t *testing.T) {
+	utils.ConfigureCookies(config.CookieConfig{Name: "session", Path: "/", CSRFCookieName: "csrf", CSRFHeaderName: "X-CSRF-Token"})
+
+	w := handle(httptest.NewRequest(http.MethodGet, "/", nil), CSRF)
+	var issued *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "csrf" {
+			issued = cookie
+		}
+	}
+	if issued == nil || len(issued.Value) != 64 || issued.HttpOnly {
+		t.Fatalf("CSRF cookie = %+v, want a 64-character token scripts can read", issued)
+	}
+
+	// The issued token then authorizes a state-changing request.
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "token"})
+	req.AddCookie(issued)
+	req.Header.Set("X-CSRF-Token", issued.Value)
+	if w := handle(req, CSRF); w.Code != http.StatusOK {
+		t.Errorf("status = %d with the issued token, want 200", w.Code)
+	}
+
+	// A request already carrying a token is not issued another.
+	if cookies := handle(req, CSRF).Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("reissued cookies %v", cookies)
+	}
+}
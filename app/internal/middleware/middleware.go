@@ -3,36 +3,58 @@ package middleware
 import (
 	"homework/app/internal/utils"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-func Auth(c *gin.Context) {
-	tokenString, err := c.Cookie("token")
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token missing"})
-		c.Abort()
-		return
+// bearerToken returns the token from an "Authorization: Bearer" header, if any.
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// authenticate returns the username the request's token was issued to, or
+// the reason it has none.
+func authenticate(c *gin.Context) (string, string) {
+	tokenString := bearerToken(c)
+	if tokenString == "" {
+		tokenString, _ = c.Cookie(utils.CookieSettings().Name)
+	}
+	if tokenString == "" {
+		return "", "Token missing"
 	}
 
 	token, err := utils.VerifyToken(tokenString)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token verification failed"})
-		c.Abort()
-		return
+		return "", "Token verification failed"
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-		c.Abort()
-		return
+		return "", "Invalid token claims"
 	}
 
 	username, ok := claims["sub"].(string)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token payload"})
+		return "", "Invalid token payload"
+	}
+	return username, ""
+}
+
+// Auth requires a valid token, or a request APIKey authenticated already.
+func Auth(c *gin.Context) {
+	if _, ok := c.Get("username"); ok {
+		c.Next()
+		return
+	}
+	username, problem := authenticate(c)
+	if problem != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": problem})
 		c.Abort()
 		return
 	}
@@ -40,3 +62,16 @@ func Auth(c *gin.Context) {
 	c.Set("username", username)
 	c.Next()
 }
+
+// OptionalAuth identifies the user on routes that are also open to
+// anonymous requests. Requests without a valid token continue anonymously.
+func OptionalAuth(c *gin.Context) {
+	if _, ok := c.Get("username"); ok {
+		c.Next()
+		return
+	}
+	if username, problem := authenticate(c); problem == "" {
+		c.Set("username", username)
+	}
+	c.Next()
+}
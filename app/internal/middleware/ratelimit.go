@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"homework/app/internal/config"
+	"homework/app/internal/ratelimit"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit limits requests to a route according to policy. name
+// distinguishes buckets of different routes sharing one store. Keying by
+// user requires Auth to run first, and keying by API key APIKey, so that
+// only verified credentials pick the bucket. Requests without the key fall
+// back to the user, then to the client IP, which only comes from
+// X-Forwarded-For behind a trusted proxy. If the store fails the request is
+// let through.
+func RateLimit(store ratelimit.Store, name string, policy config.RateLimitPolicy) gin.HandlerFunc {
+	p := ratelimit.Policy{
+		Rate:  float64(policy.Requests) / policy.Per.Seconds(),
+		Burst: policy.Burst,
+	}
+
+	return func(c *gin.Context) {
+		key := name + ":" + rateLimitKey(c, policy.Key)
+
+		res, err := store.Take(c.Request.Context(), key, p)
+		if err != nil {
+			log.Printf("Rate limit store error for %s: %v", key, err)
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", ceilSeconds(res.ResetAfter))
+
+		if !res.Allowed {
+			h.Set("Retry-After", ceilSeconds(res.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func rateLimitKey(c *gin.Context, kind string) string {
+	if kind == "api_key" {
+		if keyID, ok := c.Get("api_key_id"); ok {
+			return "key:" + strconv.Itoa(keyID.(int))
+		}
+	}
+	if kind == "user" || kind == "api_key" {
+		if username, ok := c.Get("username"); ok {
+			return "user:" + username.(string)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"homework/app/internal/config"
+	"homework/app/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// stubStore answers every Take with res and err, recording the key.
+type stubStore struct {
+	res ratelimit.Result
+	err error
+	key string
+}
+
+func (s *stubStore) Take(_ context.Context, key string, _ ratelimit.Policy) (ratelimit.Result, error) {
+	s.key = key
+	return s.res, s.err
+}
+
+// serve runs a GET request from 192.0.2.1 through handlers.
+func serve(handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	handlers = append(handlers, func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/", handlers...)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitResponses(t *testing.T) {
+	policy := config.RateLimitPolicy{Requests: 10, Per: time.Minute, Burst: 5, Key: "ip"}
+	tests := []struct {
+		name    string
+		store   *stubStore
+		status  int
+		headers map[string]string
+	}{
+		{"allowed", &stubStore{res: ratelimit.Result{Allowed: true, Limit: 5, Remaining: 4, ResetAfter: 6 * time.Second}},
+			http.StatusOK, map[string]string{"RateLimit-Limit": "5", "RateLimit-Remaining": "4", "RateLimit-Reset": "6", "Retry-After": ""}},
+		{"limited", &stubStore{res: ratelimit.Result{Limit: 5, RetryAfter: 1500 * time.Millisecond, ResetAfter: 30 * time.Second}},
+			http.StatusTooManyRequests, map[string]string{"RateLimit-Limit": "5", "RateLimit-Remaining": "0", "RateLimit-Reset": "30", "Retry-After": "2"}},
+		{"store failing", &stubStore{err: errors.New("down")},
+			http.StatusOK, map[string]string{"RateLimit-Limit": "", "Retry-After": ""}},
+	}
+	for _, tt := range tests {
+		w := serve(RateLimit(tt.store, "login", policy))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		for header, want := range tt.headers {
+			if got := w.Header().Get(header); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, header, got, want)
+			}
+		}
+		if tt.store.key != "login:ip:192.0.2.1" {
+			t.Errorf("%s: bucket %q, want login:ip:192.0.2.1", tt.name, tt.store.key)
+		}
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	anonymous := func(c *gin.Context) {}
+	user := func(c *gin.Context) { c.Set("username", "alice") }
+	apiKey := func(c *gin.Context) {
+		c.Set("username", "alice")
+		c.Set("api_key_id", 7)
+	}
+	tests := []struct {
+		kind  string
+		setup gin.HandlerFunc
+		want  string
+	}{
+		{"ip", apiKey, "ip:192.0.2.1"},
+		{"user", anonymous, "ip:192.0.2.1"},
+		{"user", user, "user:alice"},
+		{"user", apiKey, "user:alice"},
+		{"api_key", anonymous, "ip:192.0.2.1"},
+		{"api_key", user, "user:alice"},
+		{"api_key", apiKey, "key:7"},
+	}
+	for _, tt := range tests {
+		var got string
+		serve(tt.setup, func(c *gin.Context) { got = rateLimitKey(c, tt.kind) })
+		if got != tt.want {
+			t.Errorf("rateLimitKey(%s) = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// APIKey authenticates requests carrying it in the X-API-Key header as its
+// user. Prefix is the start of the key, kept to tell keys apart.
+type APIKey struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	Name      string     `json:"name" db:"name"`
+	Prefix    string     `json:"prefix" db:"prefix"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+type CreateAPIKeyPayload struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
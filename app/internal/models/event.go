@@ -4,6 +4,24 @@ import (
 	"time"
 )
 
+// Event visibilities. Unlisted events are left out of listings but open to
+// anyone who has their id; private events only to invitees.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Event statuses. Events start as drafts and only published events take
+// registrations. A draft can be abandoned by cancelling it; completed and
+// cancelled are final.
+const (
+	EventDraft     = "draft"
+	EventPublished = "published"
+	EventCompleted = "completed"
+	EventCancelled = "cancelled"
+)
+
 type Event struct {
 	ID               int       `json:"id" db:"id"`
 	Name             string    `json:"name" db:"name"`
@@ -14,13 +32,67 @@ type Event struct {
 	ParticipantCount int       `json:"participant_count" db:"participant_count"`
 	Date             time.Time `json:"date_event" db:"date_event"`
 	CreatedBy        int       `json:"created_by" db:"created_by"`
+	Capacity         *int      `json:"capacity" db:"capacity"`
+	// Occurrences of a recurring series carry the series and the date the
+	// rule produced them for; Detached marks one edited on its own.
+	SeriesID       *int       `json:"series_id" db:"series_id"`
+	OccurrenceDate *time.Time `json:"occurrence_date" db:"occurrence_date"`
+	Detached       bool       `json:"detached" db:"detached"`
+	CancelledAt    *time.Time `json:"cancelled_at" db:"cancelled_at"`
+	Status         string     `json:"status" db:"status"`
+	PublishedAt    *time.Time `json:"published_at" db:"published_at"`
+	// RequiresApproval makes registrations pending until an organizer
+	// approves them.
+	RequiresApproval bool `json:"requires_approval" db:"requires_approval"`
+	// TransfersEnabled lets participants hand their registration to
+	// another user.
+	TransfersEnabled bool   `json:"transfers_enabled" db:"transfers_enabled"`
+	Visibility       string `json:"visibility" db:"visibility"`
 }
 
+// Layouts of the times and dates in event payloads.
+const (
+	TimeFormat = "15:04"
+	DateFormat = "02-01-06"
+)
+
 type CreateEventPayload struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description" binding:"required"`
-	Location    string `json:"location" binding:"required"`
-	StartTime   string `json:"start_time" binding:"required"`
-	EndTime     string `json:"end_time" binding:"required"`
-	Date        string `json:"date" binding:"required"`
+	Name             string `json:"name" binding:"required"`
+	Description      string `json:"description" binding:"required"`
+	Location         string `json:"location" binding:"required"`
+	StartTime        string `json:"start_time" binding:"required"`
+	EndTime          string `json:"end_time" binding:"required"`
+	Date             string `json:"date" binding:"required"`
+	Capacity         *int   `json:"capacity" binding:"omitempty,min=1"`
+	RequiresApproval bool   `json:"requires_approval"`
+	// TransfersEnabled defaults to true.
+	TransfersEnabled *bool `json:"transfers_enabled"`
+	// Visibility defaults to public.
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public unlisted private"`
+	// Publish makes the event live at once instead of starting as a draft.
+	Publish bool `json:"publish"`
+}
+
+// Edit scopes for an occurrence of a recurring series.
+const (
+	ScopeThis      = "this"
+	ScopeFollowing = "following"
+	ScopeAll       = "all"
+)
+
+// UpdateEventPayload changes only the fields that are present.
+type UpdateEventPayload struct {
+	Name             *string `json:"name"`
+	Description      *string `json:"description"`
+	Location         *string `json:"location"`
+	StartTime        *string `json:"start_time"`
+	EndTime          *string `json:"end_time"`
+	Date             *string `json:"date"`
+	Capacity         *int    `json:"capacity" binding:"omitempty,min=1"`
+	RequiresApproval *bool   `json:"requires_approval"`
+	TransfersEnabled *bool   `json:"transfers_enabled"`
+	Visibility       *string `json:"visibility" binding:"omitempty,oneof=public unlisted private"`
+	// RRule replaces the recurrence rule of the series; only allowed with
+	// the "following" and "all" scopes.
+	RRule *string `json:"rrule"`
 }
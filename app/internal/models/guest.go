@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// Guest holds one of the seats of a group registration other than the
+// participant's own. Guests need no account; the participant manages them
+// and passes on their tickets.
+type Guest struct {
+	ID             int        `json:"id" db:"id"`
+	RegistrationID int        `json:"registration_id" db:"registration_id"`
+	Name           string     `json:"name" db:"name"`
+	Email          string     `json:"email" db:"email"`
+	TicketNonce    string     `json:"-" db:"ticket_nonce"`
+	CheckedInAt    *time.Time `json:"checked_in_at" db:"checked_in_at"`
+	CheckedInBy    *int       `json:"checked_in_by" db:"checked_in_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+type GuestPayload struct {
+	Name  string `json:"name" binding:"required,max=255"`
+	Email string `json:"email" binding:"required,email,max=255"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// InviteLink admits whoever holds its code to a private event. Code is only
+// filled in for the organizer.
+type InviteLink struct {
+	ID        int        `json:"id" db:"id"`
+	EventID   int        `json:"event_id" db:"event_id"`
+	Nonce     string     `json:"-" db:"nonce"`
+	Code      string     `json:"code" db:"-"`
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+	MaxUses   *int       `json:"max_uses" db:"max_uses"`
+	Uses      int        `json:"uses" db:"uses"`
+	CreatedBy int        `json:"created_by" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+type CreateInviteLinkPayload struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxUses   *int       `json:"max_uses" binding:"omitempty,min=1"`
+}
+
+// Invite is mailed to Email as a single-use code that admits the account
+// redeeming it to a private event.
+type Invite struct {
+	ID        int        `json:"id" db:"id"`
+	EventID   int        `json:"event_id" db:"event_id"`
+	Email     string     `json:"email" db:"email"`
+	Nonce     string     `json:"-" db:"nonce"`
+	InvitedBy int        `json:"invited_by" db:"invited_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UsedBy    *int       `json:"used_by" db:"used_by"`
+	UsedAt    *time.Time `json:"used_at" db:"used_at"`
+}
+
+type CreateInvitesPayload struct {
+	Emails []string `json:"emails" binding:"required,min=1,max=100,dive,email"`
+}
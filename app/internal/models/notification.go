@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// NotificationPreferences applies defaults for users who never saved any.
+type NotificationPreferences struct {
+	UserID         int  `json:"user_id" db:"user_id"`
+	EventReminders bool `json:"event_reminders" db:"event_reminders"`
+	EmailEnabled   bool `json:"email_enabled" db:"email_enabled"`
+}
+
+type UpdateNotificationPreferencesPayload struct {
+	EventReminders *bool `json:"event_reminders"`
+	EmailEnabled   *bool `json:"email_enabled"`
+}
+
+type Notification struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	Kind      string     `json:"kind" db:"kind"`
+	Title     string     `json:"title" db:"title"`
+	Body      string     `json:"body" db:"body"`
+	EventID   *int       `json:"event_id" db:"event_id"`
+	ReadAt    *time.Time `json:"read_at" db:"read_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
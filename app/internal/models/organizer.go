@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Organizer roles, from most to least trusted. Owners manage the organizers
+// and can cancel the event, editors change everything else about it and
+// check-in staff only check tickets and see attendance.
+const (
+	OrganizerOwner   = "owner"
+	OrganizerEditor  = "editor"
+	OrganizerCheckIn = "checkin"
+)
+
+// Organizer is a user's role on an event.
+type Organizer struct {
+	EventID   int       `json:"event_id" db:"event_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	Email     string    `json:"email" db:"email"`
+	Role      string    `json:"role" db:"role"`
+	AddedBy   *int      `json:"added_by" db:"added_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type AddOrganizerPayload struct {
+	// User is the username or email address of the organizer to add.
+	User string `json:"user" binding:"required,max=255"`
+	Role string `json:"role" binding:"required,oneof=owner editor checkin"`
+}
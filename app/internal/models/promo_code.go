@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	PromoPercentage = "percentage"
+	PromoFixed      = "fixed"
+)
+
+// PromoCode discounts ticket purchases for one event. Amount is a
+// percentage for PromoPercentage and an amount in the minor unit of
+// Currency, taken off each order, for PromoFixed. Uses counts the
+// registrations that redeemed it, except unpaid holds that expired and
+// rejected applications.
+type PromoCode struct {
+	ID            int        `json:"id" db:"id"`
+	EventID       int        `json:"event_id" db:"event_id"`
+	Code          string     `json:"code" db:"code"`
+	Kind          string     `json:"kind" db:"kind"`
+	Amount        int64      `json:"amount" db:"amount"`
+	Currency      *string    `json:"currency" db:"currency"`
+	MaxUses       *int       `json:"max_uses" db:"max_uses"`
+	PerUserLimit  *int       `json:"per_user_limit" db:"per_user_limit"`
+	ValidFrom     *time.Time `json:"valid_from" db:"valid_from"`
+	ValidUntil    *time.Time `json:"valid_until" db:"valid_until"`
+	TicketTypeIDs []int      `json:"ticket_type_ids" db:"-"`
+	Uses          int        `json:"uses" db:"uses"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+type CreatePromoCodePayload struct {
+	Code         string     `json:"code" binding:"required,max=64"`
+	Kind         string     `json:"kind" binding:"required,oneof=percentage fixed"`
+	Amount       int64      `json:"amount" binding:"required,min=1"`
+	Currency     *string    `json:"currency" binding:"omitempty,iso4217"`
+	MaxUses      *int       `json:"max_uses" binding:"omitempty,min=1"`
+	PerUserLimit *int       `json:"per_user_limit" binding:"omitempty,min=1"`
+	ValidFrom    *time.Time `json:"valid_from"`
+	ValidUntil   *time.Time `json:"valid_until"`
+	// TicketTypeIDs restricts the code to these ticket types; empty means all.
+	TicketTypeIDs []int `json:"ticket_type_ids"`
+}
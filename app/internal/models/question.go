@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of registration question and the JSON type of their answers.
+const (
+	QuestionText         = "text"          // string
+	QuestionSingleChoice = "single_choice" // one of Options
+	QuestionMultiChoice  = "multi_choice"  // array of Options
+	QuestionNumber       = "number"        // number
+	QuestionCheckbox     = "checkbox"      // boolean; required means it must be ticked
+)
+
+// Question is one field of the form participants fill in when registering
+// for an event. Questions are shown in Position order.
+type Question struct {
+	ID        int            `json:"id" db:"id"`
+	EventID   int            `json:"event_id" db:"event_id"`
+	Label     string         `json:"label" db:"label"`
+	Kind      string         `json:"kind" db:"kind"`
+	Required  bool           `json:"required" db:"required"`
+	Options   pq.StringArray `json:"options" db:"options"`
+	Position  int            `json:"position" db:"position"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+}
+
+// QuestionPayload creates a question or replaces all of its settings. The
+// kind of an existing question cannot change.
+type QuestionPayload struct {
+	Label    string   `json:"label" binding:"required,max=255"`
+	Kind     string   `json:"kind" binding:"required,oneof=text single_choice multi_choice number checkbox"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options" binding:"max=100,dive,required,max=255"`
+	Position int      `json:"position"`
+}
+
+// Answers maps question IDs to answers as submitted with a registration.
+type Answers map[int]json.RawMessage
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// RefundPolicy decides how much of a paid registration is refunded when
+// the participant cancels: everything until FullRefundDays before the
+// event starts, PartialRefundPercent until PartialRefundDays before, and
+// nothing after that.
+type RefundPolicy struct {
+	EventID              int       `json:"event_id" db:"event_id"`
+	FullRefundDays       int       `json:"full_refund_days" db:"full_refund_days"`
+	PartialRefundDays    int       `json:"partial_refund_days" db:"partial_refund_days"`
+	PartialRefundPercent int       `json:"partial_refund_percent" db:"partial_refund_percent"`
+	UpdatedAt            time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type RefundPolicyPayload struct {
+	FullRefundDays       int `json:"full_refund_days" binding:"min=0"`
+	PartialRefundDays    int `json:"partial_refund_days" binding:"min=0,ltefield=FullRefundDays"`
+	PartialRefundPercent int `json:"partial_refund_percent" binding:"min=0,max=100"`
+}
+
+const (
+	LedgerPayment = "payment"
+	LedgerRefund  = "refund"
+)
+
+// LedgerEntry records money that moved through the payment provider.
+// Reference is the provider's ID for the payment or refund.
+type LedgerEntry struct {
+	ID             int       `json:"id" db:"id"`
+	RegistrationID int       `json:"registration_id" db:"registration_id"`
+	EventID        int       `json:"event_id" db:"event_id"`
+	Kind           string    `json:"kind" db:"kind"`
+	Amount         int64     `json:"amount" db:"amount"`
+	Currency       string    `json:"currency" db:"currency"`
+	Provider       string    `json:"provider" db:"provider"`
+	Reference      string    `json:"reference" db:"reference"`
+	Note           string    `json:"note" db:"note"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
@@ -4,14 +4,77 @@ import (
 	"time"
 )
 
+const (
+	RegistrationConfirmed  = "confirmed"
+	RegistrationWaitlisted = "waitlisted"
+	RegistrationCancelled  = "cancelled"
+	// A pending_payment registration holds its seats until HoldExpiresAt;
+	// unpaid by then it becomes expired and releases them.
+	RegistrationPendingPayment = "pending_payment"
+	RegistrationExpired        = "expired"
+	// Registrations for events that require approval start out pending
+	// and hold no seats until an organizer approves or rejects them.
+	RegistrationPending  = "pending"
+	RegistrationRejected = "rejected"
+)
+
 type Registration struct {
-	ID               int       `json:"id" db:"id"`
-	EventID          int       `json:"event_id" db:"event_id"`
-	ParticipantID    int       `json:"participant_id" db:"participant_id"`
-	RegistrationDate time.Time `json:"registration_date" db:"registration_date"`
+	ID               int        `json:"id" db:"id"`
+	EventID          int        `json:"event_id" db:"event_id"`
+	ParticipantID    int        `json:"participant_id" db:"participant_id"`
+	RegistrationDate time.Time  `json:"registration_date" db:"registration_date"`
+	Status           string     `json:"status" db:"status"`
+	CancelledAt      *time.Time `json:"cancelled_at" db:"cancelled_at"`
+	TicketNonce      string     `json:"-" db:"ticket_nonce"`
+	CheckedInAt      *time.Time `json:"checked_in_at" db:"checked_in_at"`
+	CheckedInBy      *int       `json:"checked_in_by" db:"checked_in_by"`
+	TicketTypeID     *int       `json:"ticket_type_id" db:"ticket_type_id"`
+	Quantity         int        `json:"quantity" db:"quantity"`
+	Amount           int64      `json:"amount" db:"amount"`
+	Currency         string     `json:"currency" db:"currency"`
+	PaymentProvider  *string    `json:"-" db:"payment_provider"`
+	CheckoutID       *string    `json:"-" db:"checkout_id"`
+	CheckoutURL      *string    `json:"checkout_url" db:"checkout_url"`
+	PaymentID        *string    `json:"-" db:"payment_id"`
+	HoldExpiresAt    *time.Time `json:"hold_expires_at" db:"hold_expires_at"`
+	PaidAt           *time.Time `json:"paid_at" db:"paid_at"`
+	PromoCodeID      *int       `json:"promo_code_id" db:"promo_code_id"`
+	Discount         int64      `json:"discount" db:"discount"`
+	RefundAmount     int64      `json:"refund_amount" db:"refund_amount"`
+	RefundID         *string    `json:"-" db:"refund_id"`
+	RefundedAt       *time.Time `json:"refunded_at" db:"refunded_at"`
+	ReviewedAt       *time.Time `json:"reviewed_at" db:"reviewed_at"`
+	ReviewedBy       *int       `json:"reviewed_by" db:"reviewed_by"`
+	ReviewReason     *string    `json:"review_reason" db:"review_reason"`
 }
 
+// RegistrationEventPayload registers the authenticated user for an event.
 type RegistrationEventPayload struct {
-	EventID       int `json:"event_id" binding:"required"`
-	ParticipantID int `json:"participant_id" binding:"required"`
+	EventID int `json:"event_id" binding:"required"`
+	// TicketTypeID is required once the event offers ticket types.
+	TicketTypeID *int `json:"ticket_type_id"`
+	// Quantity is the number of seats, the participant's own included. It
+	// defaults to one seat for the participant and one for each guest.
+	Quantity  int            `json:"quantity" binding:"omitempty,min=1,max=50"`
+	Guests    []GuestPayload `json:"guests" binding:"max=49,dive"`
+	PromoCode string         `json:"promo_code" binding:"omitempty,max=64"`
+	// Answers to the event's registration questions, keyed by question ID.
+	Answers Answers `json:"answers"`
+	// Invite is the code of an invite link or email invite, needed for
+	// private events the participant has not been admitted to yet.
+	Invite string `json:"invite" binding:"omitempty,max=255"`
+}
+
+type CancelRegistrationPayload struct {
+	EventID int `json:"event_id" binding:"required"`
+}
+
+// ReviewRegistrationPayload approves or rejects a pending registration.
+// The reason is shown to the applicant and is required to reject.
+type ReviewRegistrationPayload struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+type CheckInPayload struct {
+	Code string `json:"code" binding:"required"`
 }
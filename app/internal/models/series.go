@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// EventSeries is the template the occurrences of a recurring event are
+// materialized from. StartDate is the DTSTART of RRule; occurrences exist as
+// ordinary events up to MaterializedUntil. Occurrences are drafts until
+// the series is published.
+type EventSeries struct {
+	ID                int         `json:"id" db:"id"`
+	Name              string      `json:"name" db:"name"`
+	Description       string      `json:"description" db:"description"`
+	Location          string      `json:"location" db:"location"`
+	StartTime         time.Time   `json:"start_time" db:"start_time"`
+	EndTime           time.Time   `json:"end_time" db:"end_time"`
+	StartDate         time.Time   `json:"start_date" db:"start_date"`
+	RRule             string      `json:"rrule" db:"rrule"`
+	ExDates           []time.Time `json:"exdates" db:"-"`
+	Capacity          *int        `json:"capacity" db:"capacity"`
+	RequiresApproval  bool        `json:"requires_approval" db:"requires_approval"`
+	TransfersEnabled  bool        `json:"transfers_enabled" db:"transfers_enabled"`
+	Visibility        string      `json:"visibility" db:"visibility"`
+	PublishedAt       *time.Time  `json:"published_at" db:"published_at"`
+	CreatedBy         int         `json:"created_by" db:"created_by"`
+	MaterializedUntil time.Time   `json:"materialized_until" db:"materialized_until"`
+	CreatedAt         time.Time   `json:"created_at" db:"created_at"`
+}
+
+// CreateEventSeriesPayload describes the first occurrence like a single
+// event, plus an RFC 5545 RRULE (without DTSTART) and dates to skip.
+type CreateEventSeriesPayload struct {
+	CreateEventPayload
+	RRule   string   `json:"rrule" binding:"required"`
+	ExDates []string `json:"exdates"`
+}
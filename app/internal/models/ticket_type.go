@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// TicketType is one kind of ticket for an event. Price is in the minor unit
+// of Currency (cents for EUR); Sold counts the seats of confirmed
+// registrations against Quantity.
+type TicketType struct {
+	ID          int        `json:"id" db:"id"`
+	EventID     int        `json:"event_id" db:"event_id"`
+	Name        string     `json:"name" db:"name"`
+	Price       int64      `json:"price" db:"price"`
+	Currency    string     `json:"currency" db:"currency"`
+	Quantity    int        `json:"quantity" db:"quantity"`
+	Sold        int        `json:"sold" db:"sold"`
+	SalesStart  *time.Time `json:"sales_start" db:"sales_start"`
+	SalesEnd    *time.Time `json:"sales_end" db:"sales_end"`
+	MinPerOrder int        `json:"min_per_order" db:"min_per_order"`
+	MaxPerOrder *int       `json:"max_per_order" db:"max_per_order"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TicketTypePayload creates a ticket type or replaces all of its settings.
+type TicketTypePayload struct {
+	Name        string     `json:"name" binding:"required,max=255"`
+	Price       int64      `json:"price" binding:"min=0"`
+	Currency    string     `json:"currency" binding:"required,iso4217"`
+	Quantity    int        `json:"quantity" binding:"required,min=1"`
+	SalesStart  *time.Time `json:"sales_start"`
+	SalesEnd    *time.Time `json:"sales_end"`
+	MinPerOrder int        `json:"min_per_order" binding:"omitempty,min=1"`
+	MaxPerOrder *int       `json:"max_per_order" binding:"omitempty,min=1"`
+}
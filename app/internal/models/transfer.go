@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+// Transfer offers a registration to another user. The recipient is named
+// by username, which sets ToUserID, or by email, which may belong to
+// someone who has no account yet.
+type Transfer struct {
+	ID             int        `json:"id" db:"id"`
+	RegistrationID int        `json:"registration_id" db:"registration_id"`
+	EventID        int        `json:"event_id" db:"event_id"`
+	EventName      string     `json:"event_name" db:"event_name"`
+	FromUserID     int        `json:"from_user_id" db:"from_user_id"`
+	ToUserID       *int       `json:"to_user_id" db:"to_user_id"`
+	ToEmail        *string    `json:"to_email" db:"to_email"`
+	Status         string     `json:"status" db:"status"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	ResolvedAt     *time.Time `json:"resolved_at" db:"resolved_at"`
+}
+
+type CreateTransferPayload struct {
+	// To is the recipient's username or email address.
+	To string `json:"to" binding:"required,max=255"`
+}
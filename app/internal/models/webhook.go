@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+type Webhook struct {
+	ID         int            `json:"id" db:"id"`
+	OwnerID    int            `json:"owner_id" db:"owner_id"`
+	URL        string         `json:"url" db:"url"`
+	Secret     string         `json:"-" db:"secret"`
+	EventTypes pq.StringArray `json:"event_types" db:"event_types"`
+	Active     bool           `json:"active" db:"active"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int            `json:"id" db:"id"`
+	WebhookID      int            `json:"webhook_id" db:"webhook_id"`
+	EventType      string         `json:"event_type" db:"event_type"`
+	Payload        types.JSONText `json:"payload" db:"payload"`
+	Status         string         `json:"status" db:"status"`
+	Attempts       int            `json:"attempts" db:"attempts"`
+	ResponseStatus *int           `json:"response_status" db:"response_status"`
+	LastError      *string        `json:"last_error" db:"last_error"`
+	RedeliveryOf   *int           `json:"redelivery_of" db:"redelivery_of"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time     `json:"delivered_at" db:"delivered_at"`
+}
+
+type CreateWebhookPayload struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types"`
+}
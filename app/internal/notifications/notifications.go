@@ -0,0 +1,52 @@
+// Package notifications writes entries to users' in-app inboxes. Every
+// function takes an sqlx.ExtContext so notifications are created in the
+// transaction of the change they describe.
+package notifications
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	KindEventUpdated        = "event_updated"
+	KindEventCancelled      = "event_cancelled"
+	KindWaitlistPromoted    = "waitlist_promoted"
+	KindNewRegistration     = "new_registration"
+	KindHoldExpired         = "hold_expired"
+	KindNewApplication      = "new_application"
+	KindApplicationApproved = "application_approved"
+	KindApplicationRejected = "application_rejected"
+	KindTransferOffered     = "transfer_offered"
+	KindTransferAccepted    = "transfer_accepted"
+	KindTransferDeclined    = "transfer_declined"
+	KindOrganizerAdded      = "organizer_added"
+)
+
+// Notify adds one notification for userID. eventID may be zero.
+func Notify(ctx context.Context, ext sqlx.ExtContext, userID int, kind, title, body string, eventID int) error {
+	query := "INSERT INTO notifications (user_id, kind, title, body, event_id) VALUES ($1, $2, $3, $4, NULLIF($5, 0))"
+	_, err := ext.ExecContext(ctx, query, userID, kind, title, body, eventID)
+	return err
+}
+
+// NotifyOrganizers notifies everyone managing eventID, that is holding the
+// editor or owner role on it.
+func NotifyOrganizers(ctx context.Context, ext sqlx.ExtContext, eventID int, kind, title, body string) error {
+	query := `INSERT INTO notifications (user_id, kind, title, body, event_id)
+		SELECT user_id, $2, $3, $4, $1 FROM event_organizers
+		WHERE event_id = $1 AND role IN ('editor', 'owner')`
+	_, err := ext.ExecContext(ctx, query, eventID, kind, title, body)
+	return err
+}
+
+// NotifyRegistrants notifies everyone holding an active registration for
+// eventID, including those on the waitlist.
+func NotifyRegistrants(ctx context.Context, ext sqlx.ExtContext, eventID int, kind, title, body string) error {
+	query := `INSERT INTO notifications (user_id, kind, title, body, event_id)
+		SELECT DISTINCT participant_id, $2, $3, $4, $1 FROM registrations
+		WHERE event_id = $1 AND status NOT IN ('cancelled', 'expired', 'rejected')`
+	_, err := ext.ExecContext(ctx, query, eventID, kind, title, body)
+	return err
+}
@@ -0,0 +1,134 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fakeSignatureHeader = "X-Fake-Signature"
+	fakeTolerance       = 5 * time.Minute
+)
+
+var ErrUnknownCheckout = errors.New("unknown checkout")
+
+// Fake is an in-process PaymentProvider for development and tests. Nothing
+// is charged: a checkout is paid by posting the signed webhook Complete
+// builds, exactly as a real provider would deliver it. Checkouts live in
+// memory, so they only survive as long as the process, as do the refunds
+// remembered for their idempotency keys.
+type Fake struct {
+	secret  []byte
+	baseURL string
+
+	mu        sync.Mutex
+	checkouts map[string]CheckoutRequest
+	refunds   map[string]Refund
+}
+
+func NewFake(secret []byte, baseURL string) *Fake {
+	return &Fake{secret: secret, baseURL: strings.TrimSuffix(baseURL, "/"), checkouts: make(map[string]CheckoutRequest), refunds: make(map[string]Refund)}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func fakeID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func (f *Fake) CreateCheckout(ctx context.Context, req CheckoutRequest) (Checkout, error) {
+	id := fakeID("fake_cs_")
+	f.mu.Lock()
+	f.checkouts[id] = req
+	f.mu.Unlock()
+	return Checkout{ID: id, URL: f.baseURL + "/payments/fake/checkouts/" + id + "/complete"}, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, req RefundRequest) (Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if refund, ok := f.refunds[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		return refund, nil
+	}
+	refund := Refund{ID: fakeID("fake_re_"), Amount: req.Amount}
+	f.refunds[req.IdempotencyKey] = refund
+	return refund, nil
+}
+
+func (f *Fake) sign(timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, f.secret)
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Complete pays checkoutID and returns the signed webhook reporting it.
+func (f *Fake) Complete(checkoutID string) (http.Header, []byte, error) {
+	f.mu.Lock()
+	req, ok := f.checkouts[checkoutID]
+	delete(f.checkouts, checkoutID)
+	f.mu.Unlock()
+	if !ok {
+		return nil, nil, ErrUnknownCheckout
+	}
+
+	body, err := json.Marshal(WebhookEvent{
+		Type:       EventCheckoutCompleted,
+		CheckoutID: checkoutID,
+		PaymentID:  fakeID("fake_pi_"),
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	timestamp := time.Now().Unix()
+	header := http.Header{}
+	header.Set(fakeSignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, f.sign(timestamp, body)))
+	return header, body, nil
+}
+
+// VerifyWebhook checks the "t=<unix>,v1=<hex>" signature header and rejects
+// webhooks signed too long ago to stop replays.
+func (f *Fake) VerifyWebhook(header http.Header, body []byte) (WebhookEvent, error) {
+	var event WebhookEvent
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header.Get(fakeSignatureHeader), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return event, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > fakeTolerance || age < -fakeTolerance {
+		return event, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(f.sign(timestamp, body))) {
+		return event, ErrInvalidSignature
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return event, err
+	}
+	return event, nil
+}
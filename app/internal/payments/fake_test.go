@@ -0,0 +1,29 @@
+package payments
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFakeRefundIsIdempotent(t *testing.T) {
+	fake := NewFake([]byte("secret"), "http://localhost")
+	ctx := context.Background()
+	req := RefundRequest{PaymentID: "pi_1", Amount: 2500, Currency: "EUR", IdempotencyKey: "registration-1-refund"}
+
+	first, err := fake.Refund(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried, err := fake.Refund(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != first {
+		t.Errorf("retried refund = %+v, want the first %+v", retried, first)
+	}
+
+	req.IdempotencyKey = "registration-2-refund"
+	if other, _ := fake.Refund(ctx, req); other.ID == first.ID {
+		t.Errorf("refund under another key reused %s", first.ID)
+	}
+}
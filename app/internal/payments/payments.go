@@ -0,0 +1,94 @@
+// Package payments takes payment for tickets through an external provider.
+//
+// A paid registration holds its seats while the participant completes a
+// checkout hosted by the provider. The provider reports the outcome with a
+// signed webhook; holds that are never paid expire and free their seats.
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"homework/app/internal/config"
+	"net/http"
+	"time"
+)
+
+const (
+	EventCheckoutCompleted = "checkout.completed"
+	EventCheckoutExpired   = "checkout.expired"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+type CheckoutRequest struct {
+	// Reference identifies the registration the checkout pays for.
+	Reference   string
+	Amount      int64
+	Currency    string
+	Description string
+	ExpiresAt   time.Time
+}
+
+type Checkout struct {
+	ID  string
+	URL string
+}
+
+// WebhookEvent is a verified notification from the provider about a
+// checkout.
+type WebhookEvent struct {
+	Type       string `json:"type"`
+	CheckoutID string `json:"checkout_id"`
+	PaymentID  string `json:"payment_id"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency"`
+}
+
+type RefundRequest struct {
+	PaymentID string
+	Amount    int64
+	Currency  string
+	// IdempotencyKey identifies the refund across retries; the provider
+	// pays a key out once and answers repeats with the same refund.
+	IdempotencyKey string
+}
+
+type Refund struct {
+	ID     string
+	Amount int64
+}
+
+type PaymentProvider interface {
+	Name() string
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (Checkout, error)
+	// VerifyWebhook authenticates a webhook request from its headers and raw
+	// body and decodes the event it carries.
+	VerifyWebhook(header http.Header, body []byte) (WebhookEvent, error)
+	Refund(ctx context.Context, req RefundRequest) (Refund, error)
+}
+
+var holdTTL = 15 * time.Minute
+
+// Configure sets how long seats are held for payment. It must be called
+// once at startup.
+func Configure(cfg config.PaymentsConfig) {
+	holdTTL = cfg.HoldTTL
+}
+
+// HoldDeadline is when a seat held from now expires unless paid for.
+func HoldDeadline() time.Time {
+	return time.Now().Add(holdTTL)
+}
+
+// New returns the provider cfg selects.
+func New(cfg config.PaymentsConfig, auth config.AuthConfig) PaymentProvider {
+	secret := []byte(cfg.WebhookSecret)
+	if len(secret) == 0 {
+		mac := hmac.New(sha256.New, []byte(auth.SigningKey))
+		mac.Write([]byte("payments"))
+		secret = mac.Sum(nil)
+	}
+	return NewFake(secret, cfg.CheckoutBaseURL)
+}
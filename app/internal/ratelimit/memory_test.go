@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	policy := Policy{Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	steps := []struct {
+		key     string
+		advance time.Duration
+		allowed bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+		{"b", 0, true}, // buckets are per key
+		{"a", 999 * time.Millisecond, false},
+		{"a", time.Millisecond, true},
+		{"a", 0, false},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		res, err := s.Take(ctx, step.key, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != step.allowed {
+			t.Errorf("step %d: take %q allowed = %v, want %v", i, step.key, res.Allowed, step.allowed)
+		}
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.lastSweep = now
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.Take(ctx, "fast", Policy{Rate: 1, Burst: 1})
+	s.Take(ctx, "slow", Policy{Rate: 1.0 / 3600, Burst: 1})
+
+	now = now.Add(memorySweepInterval)
+	s.Take(ctx, "other", Policy{Rate: 1, Burst: 1})
+	if _, ok := s.buckets["fast"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := s.buckets["slow"]; !ok {
+		t.Error("bucket still refilling was swept")
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const postgresPruneInterval = time.Hour
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every replica
+// sees the same limits. Each Take locks its row for the length of a short
+// transaction and uses the database clock to avoid skew between replicas.
+type PostgresStore struct {
+	db        *sqlx.DB
+	lastPrune atomic.Int64
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	s := &PostgresStore{db: db}
+	s.lastPrune.Store(time.Now().Unix())
+	return s
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	s.maybePrune(ctx)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES ($1, $2, now()) ON CONFLICT (key) DO NOTHING"
+	if _, err := tx.ExecContext(ctx, query, key, policy.Burst); err != nil {
+		return Result{}, err
+	}
+
+	var row struct {
+		Tokens    float64   `db:"tokens"`
+		UpdatedAt time.Time `db:"updated_at"`
+		Now       time.Time `db:"now"`
+	}
+	query = "SELECT tokens, updated_at, now() AS now FROM rate_limit_buckets WHERE key = $1 FOR UPDATE"
+	if err := tx.GetContext(ctx, &row, query, key); err != nil {
+		return Result{}, err
+	}
+
+	tokens, res := take(row.Tokens, row.UpdatedAt, row.Now, policy)
+
+	query = "UPDATE rate_limit_buckets SET tokens = $1, updated_at = $2 WHERE key = $3"
+	if _, err := tx.ExecContext(ctx, query, tokens, row.Now, key); err != nil {
+		return Result{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// maybePrune deletes idle buckets at most once per interval per replica.
+func (s *PostgresStore) maybePrune(ctx context.Context) {
+	last := s.lastPrune.Load()
+	now := time.Now().Unix()
+	if now-last < int64(postgresPruneInterval.Seconds()) || !s.lastPrune.CompareAndSwap(last, now) {
+		return
+	}
+	query := "DELETE FROM rate_limit_buckets WHERE updated_at < now() - interval '1 day'"
+	s.db.ExecContext(ctx, query)
+}
@@ -0,0 +1,55 @@
+// Package ratelimit implements token buckets behind a pluggable Store so that
+// limits can live in process memory or be shared between replicas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy allows Burst requests at once, refilled at Rate tokens per second.
+type Policy struct {
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next token is available.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+type Store interface {
+	// Take removes one token from the bucket identified by key.
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// take refills a bucket holding tokens as of updated and tries to spend one
+// token at now. It returns the new token count and the outcome.
+func take(tokens float64, updated, now time.Time, policy Policy) (float64, Result) {
+	burst := float64(policy.Burst)
+	elapsed := now.Sub(updated).Seconds()
+	if elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*policy.Rate)
+	}
+
+	res := Result{Limit: policy.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - tokens) / policy.Rate)
+	}
+	res.Remaining = int(math.Floor(tokens))
+	res.ResetAfter = secondsToDuration((burst - tokens) / policy.Rate)
+	return tokens, res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	base := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	perSecond := Policy{Rate: 1, Burst: 3}
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		policy     Policy
+		wantTokens float64
+		want       Result
+	}{
+		{"full bucket", 3, 0, perSecond, 2,
+			Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second}},
+		{"last token", 1, 0, perSecond, 0,
+			Result{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second}},
+		{"empty bucket", 0, 0, perSecond, 0,
+			Result{Limit: 3, RetryAfter: time.Second, ResetAfter: 3 * time.Second}},
+		{"half refilled", 0, 500 * time.Millisecond, perSecond, 0.5,
+			Result{Limit: 3, RetryAfter: 500 * time.Millisecond, ResetAfter: 2500 * time.Millisecond}},
+		{"refill capped at burst", 0, time.Hour, perSecond, 2,
+			Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second}},
+		{"clock moved back", 1, -time.Minute, perSecond, 0,
+			Result{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second}},
+		{"slow rate", 0, 0, Policy{Rate: 0.5, Burst: 1}, 0,
+			Result{Limit: 1, RetryAfter: 2 * time.Second, ResetAfter: 2 * time.Second}},
+	}
+	for _, tt := range tests {
+		tokens, got := take(tt.tokens, base, base.Add(tt.elapsed), tt.policy)
+		if tokens != tt.wantTokens || got != tt.want {
+			t.Errorf("%s: take = %v, %+v; want %v, %+v", tt.name, tokens, got, tt.wantTokens, tt.want)
+		}
+	}
+}
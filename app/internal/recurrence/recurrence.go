@@ -0,0 +1,310 @@
+// Package recurrence expands the RRULE of an event series into ordinary
+// event rows.
+//
+// Occurrences are materialized up to a rolling horizon so each one can be
+// registered for, edited and cancelled on its own. A row is keyed by its
+// series and occurrence date, so materializing is idempotent and safe to run
+// from several replicas at once.
+package recurrence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"homework/app/internal/config"
+	"homework/app/internal/models"
+	"homework/app/internal/webhooks"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/teambition/rrule-go"
+)
+
+var (
+	ErrInvalidRule = errors.New("Invalid recurrence rule")
+	ErrRuleTooFine = errors.New("Recurrence rule must not repeat more than once a day")
+)
+
+// ParseRule validates an RRULE value. DTSTART comes from the series start
+// date and times of day from its start and end time, so neither may appear
+// in the rule.
+func ParseRule(rule string) (*rrule.ROption, error) {
+	opt, err := rrule.StrToROption(rule)
+	if err != nil || !opt.Dtstart.IsZero() {
+		return nil, ErrInvalidRule
+	}
+	if opt.Freq > rrule.DAILY || len(opt.Byhour) > 0 || len(opt.Byminute) > 0 || len(opt.Bysecond) > 0 {
+		return nil, ErrRuleTooFine
+	}
+	if opt.Count < 0 || opt.Interval < 0 {
+		return nil, ErrInvalidRule
+	}
+	return opt, nil
+}
+
+// Day truncates t to midnight UTC, the form occurrence dates are compared in.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func newRule(rule string, start time.Time) (*rrule.RRule, error) {
+	opt, err := ParseRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	opt.Dtstart = Day(start)
+	return rrule.NewRRule(*opt)
+}
+
+// Expand returns the occurrence dates of series from from through until,
+// both inclusive, leaving out its exdates.
+func Expand(series models.EventSeries, from, until time.Time) ([]time.Time, error) {
+	r, err := newRule(series.RRule, series.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	exdates := make(map[time.Time]bool, len(series.ExDates))
+	for _, exdate := range series.ExDates {
+		exdates[Day(exdate)] = true
+	}
+
+	var dates []time.Time
+	for _, t := range r.Between(Day(from), Day(until), true) {
+		if !exdates[Day(t)] {
+			dates = append(dates, Day(t))
+		}
+	}
+	return dates, nil
+}
+
+// Split divides the rule of series at the occurrence on at: head ends the day
+// before, tail produces the remaining occurrences when started on at. A COUNT
+// is shared out between the two.
+func Split(series models.EventSeries, at time.Time) (head, tail string, err error) {
+	opt, err := ParseRule(series.RRule)
+	if err != nil {
+		return "", "", err
+	}
+	at = Day(at)
+	headOpt, tailOpt := *opt, *opt
+
+	if opt.Count > 0 {
+		r, err := newRule(series.RRule, series.StartDate)
+		if err != nil {
+			return "", "", err
+		}
+		before := len(r.Between(Day(series.StartDate), at.AddDate(0, 0, -1), true))
+		tailOpt.Count = max(opt.Count-before, 1)
+	}
+	headOpt.Count = 0
+	headOpt.Until = at.AddDate(0, 0, -1)
+	return headOpt.RRuleString(), tailOpt.RRuleString(), nil
+}
+
+// LoadSeries locks a series row and loads its exdates.
+func LoadSeries(ctx context.Context, tx *sqlx.Tx, id int) (models.EventSeries, error) {
+	var series models.EventSeries
+	query := `SELECT id, name, description, location, start_time, end_time, start_date, rrule, capacity, requires_approval, transfers_enabled, visibility, published_at, created_by, materialized_until, created_at
+		FROM event_series WHERE id = $1 FOR UPDATE`
+	if err := tx.GetContext(ctx, &series, query, id); err != nil {
+		return series, err
+	}
+	query = "SELECT exdate FROM event_series_exdates WHERE series_id = $1 ORDER BY exdate"
+	if err := tx.SelectContext(ctx, &series.ExDates, query, id); err != nil {
+		return series, err
+	}
+	return series, nil
+}
+
+type Materializer struct {
+	db       *sqlx.DB
+	horizon  time.Duration
+	interval time.Duration
+}
+
+func NewMaterializer(db *sqlx.DB, cfg config.RecurrenceConfig) *Materializer {
+	return &Materializer{db: db, horizon: cfg.Horizon, interval: cfg.Interval}
+}
+
+// Horizon is the last day occurrences should currently exist for.
+func (m *Materializer) Horizon() time.Time {
+	return Day(time.Now().UTC().Add(m.horizon))
+}
+
+// Run extends every series to the horizon each interval until ctx is
+// cancelled.
+func (m *Materializer) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.ExtendAll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Materializing recurring events failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExtendAll materializes the occurrences that moved into the horizon since
+// the last run, one series per transaction.
+func (m *Materializer) ExtendAll(ctx context.Context) error {
+	horizon := m.Horizon()
+	var ids []int
+	query := "SELECT id FROM event_series WHERE materialized_until < $1 ORDER BY id"
+	if err := m.db.SelectContext(ctx, &ids, query, horizon); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := m.extend(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Materializer) extend(ctx context.Context, id int) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	series, err := LoadSeries(ctx, tx, id)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := m.Materialize(ctx, tx, &series); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Materialize inserts the occurrences of series between its
+// MaterializedUntil and the horizon and returns them. The caller must hold
+// the series row lock.
+func (m *Materializer) Materialize(ctx context.Context, tx *sqlx.Tx, series *models.EventSeries) ([]models.Event, error) {
+	horizon := m.Horizon()
+	if !Day(series.MaterializedUntil).Before(horizon) {
+		return nil, nil
+	}
+	dates, err := Expand(*series, Day(series.MaterializedUntil).AddDate(0, 0, 1), horizon)
+	if err != nil {
+		return nil, err
+	}
+	events, err := insertOccurrences(ctx, tx, *series, dates)
+	if err != nil {
+		return nil, err
+	}
+
+	series.MaterializedUntil = horizon
+	query := "UPDATE event_series SET materialized_until = $1 WHERE id = $2"
+	if _, err := tx.ExecContext(ctx, query, horizon, series.ID); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Reconcile brings the materialized occurrences from from onwards in line
+// with the current rule of series after it changed. Missing occurrences are
+// inserted; the IDs of live ones the rule no longer produces are returned
+// for the caller to cancel. The caller must hold the series row lock.
+func (m *Materializer) Reconcile(ctx context.Context, tx *sqlx.Tx, series *models.EventSeries, from time.Time) ([]int, error) {
+	dates, err := Expand(*series, from, series.MaterializedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []models.Event
+	query := "SELECT id, occurrence_date FROM events WHERE series_id = $1 AND occurrence_date >= $2 AND status IN ('draft', 'published')"
+	if err := tx.SelectContext(ctx, &existing, query, series.ID, Day(from)); err != nil {
+		return nil, err
+	}
+	var stale []int
+	for _, event := range existing {
+		if !slices.ContainsFunc(dates, func(d time.Time) bool { return d.Equal(Day(*event.OccurrenceDate)) }) {
+			stale = append(stale, event.ID)
+		}
+	}
+
+	if _, err := insertOccurrences(ctx, tx, *series, dates); err != nil {
+		return nil, err
+	}
+	if _, err := m.Materialize(ctx, tx, series); err != nil {
+		return nil, err
+	}
+	return stale, nil
+}
+
+// insertOccurrences creates the events of series for dates, skipping dates
+// that already have one, and announces each new event to the organizer's
+// webhooks.
+func insertOccurrences(ctx context.Context, tx *sqlx.Tx, series models.EventSeries, dates []time.Time) ([]models.Event, error) {
+	query := `INSERT INTO events (name, description, location, start_time, end_time, participant_count, date_event, created_by, capacity, series_id, occurrence_date, requires_approval, transfers_enabled, visibility, status, published_at)
+		VALUES (:name, :description, :location, :start_time, :end_time, :participant_count, :date_event, :created_by, :capacity, :series_id, :occurrence_date, :requires_approval, :transfers_enabled, :visibility, :status, :published_at)
+		ON CONFLICT (series_id, occurrence_date) DO NOTHING
+		RETURNING id`
+	var created []models.Event
+	for _, date := range dates {
+		event := models.Event{
+			Name:             series.Name,
+			Description:      series.Description,
+			Location:         series.Location,
+			StartTime:        series.StartTime,
+			EndTime:          series.EndTime,
+			Date:             date,
+			CreatedBy:        series.CreatedBy,
+			Capacity:         series.Capacity,
+			SeriesID:         &series.ID,
+			OccurrenceDate:   &date,
+			RequiresApproval: series.RequiresApproval,
+			TransfersEnabled: series.TransfersEnabled,
+			Visibility:       series.Visibility,
+			Status:           models.EventDraft,
+		}
+		if series.PublishedAt != nil {
+			now := time.Now()
+			event.Status, event.PublishedAt = models.EventPublished, &now
+		}
+		q, args, err := tx.BindNamed(query, event)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.GetContext(ctx, &event.ID, q, args...)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if err := insertOrganizers(ctx, tx, event); err != nil {
+			return nil, err
+		}
+		if err := webhooks.PublishToOrganizers(ctx, tx, event.ID, webhooks.EventEventCreated, event); err != nil {
+			return nil, err
+		}
+		created = append(created, event)
+	}
+	return created, nil
+}
+
+// insertOrganizers makes the series' creator owner of a new occurrence and
+// gives everyone organizing the latest other occurrence the same role on it.
+func insertOrganizers(ctx context.Context, tx *sqlx.Tx, event models.Event) error {
+	query := "INSERT INTO event_organizers (event_id, user_id, role) VALUES ($1, $2, 'owner')"
+	if _, err := tx.ExecContext(ctx, query, event.ID, event.CreatedBy); err != nil {
+		return err
+	}
+	query = `INSERT INTO event_organizers (event_id, user_id, role, added_by)
+		SELECT $1, user_id, role, added_by FROM event_organizers
+		WHERE event_id = (SELECT id FROM events WHERE series_id = $2 AND id <> $1 ORDER BY occurrence_date DESC LIMIT 1)
+		ON CONFLICT (event_id, user_id) DO NOTHING`
+	_, err := tx.ExecContext(ctx, query, event.ID, *event.SeriesID)
+	return err
+}
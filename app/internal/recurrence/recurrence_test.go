@@ -0,0 +1,105 @@
+package recurrence
+
+import (
+	"homework/app/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestExpand(t *testing.T) {
+	start := date(2026, 11, 2) // a Monday
+	tests := []struct {
+		name        string
+		rule        string
+		exdates     []time.Time
+		from, until time.Time
+		want        []time.Time
+	}{
+		{"daily", "FREQ=DAILY", nil, start, date(2026, 11, 4),
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 3), date(2026, 11, 4)}},
+		{"window after the start", "FREQ=WEEKLY", nil, date(2026, 11, 10), date(2026, 11, 30),
+			[]time.Time{date(2026, 11, 16), date(2026, 11, 23), date(2026, 11, 30)}},
+		{"exdate left out", "FREQ=WEEKLY;COUNT=3", []time.Time{date(2026, 11, 9)}, start, date(2026, 12, 31),
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 16)}},
+		{"exdate with a time of day", "FREQ=DAILY;COUNT=2", []time.Time{time.Date(2026, 11, 3, 18, 0, 0, 0, time.UTC)}, start, date(2026, 12, 31),
+			[]time.Time{date(2026, 11, 2)}},
+		{"until is inclusive", "FREQ=DAILY;UNTIL=20261104T000000Z", nil, start, date(2026, 12, 31),
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 3), date(2026, 11, 4)}},
+		{"window ends before until", "FREQ=DAILY;UNTIL=20261104T000000Z", nil, start, date(2026, 11, 3),
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 3)}},
+		{"until before the start", "FREQ=DAILY;UNTIL=20261101T000000Z", nil, start, date(2026, 12, 31), nil},
+		{"count", "FREQ=MONTHLY;COUNT=2", nil, start, date(2027, 12, 31),
+			[]time.Time{date(2026, 11, 2), date(2026, 12, 2)}},
+	}
+	for _, tt := range tests {
+		series := models.EventSeries{RRule: tt.rule, StartDate: start, ExDates: tt.exdates}
+		got, err := Expand(series, tt.from, tt.until)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Expand = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpandRejectsBadRules(t *testing.T) {
+	for _, rule := range []string{"", "FREQ=HOURLY", "FREQ=DAILY;BYHOUR=9", "FREQ=DAILY;DTSTART=20261102T000000Z", "FREQ=SOMETIMES"} {
+		series := models.EventSeries{RRule: rule, StartDate: date(2026, 11, 2)}
+		if _, err := Expand(series, series.StartDate, date(2026, 12, 31)); err == nil {
+			t.Errorf("Expand(%q) succeeded, want an error", rule)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	start := date(2026, 11, 2)
+	tests := []struct {
+		name     string
+		rule     string
+		at       time.Time
+		wantHead []time.Time
+		wantTail []time.Time
+	}{
+		{"open-ended", "FREQ=WEEKLY;UNTIL=20261130T000000Z", date(2026, 11, 16),
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 9)},
+			[]time.Time{date(2026, 11, 16), date(2026, 11, 23), date(2026, 11, 30)}},
+		{"count shared out", "FREQ=WEEKLY;COUNT=4", date(2026, 11, 16),
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 9)},
+			[]time.Time{date(2026, 11, 16), date(2026, 11, 23)}},
+		{"on the first occurrence", "FREQ=WEEKLY;COUNT=3", start,
+			nil,
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 9), date(2026, 11, 16)}},
+		{"on the last occurrence", "FREQ=WEEKLY;COUNT=3", date(2026, 11, 16),
+			[]time.Time{date(2026, 11, 2), date(2026, 11, 9)},
+			[]time.Time{date(2026, 11, 16)}},
+	}
+	for _, tt := range tests {
+		series := models.EventSeries{RRule: tt.rule, StartDate: start}
+		head, tail, err := Split(series, tt.at.Add(18*time.Hour))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		until := date(2027, 12, 31)
+		gotHead, err := Expand(models.EventSeries{RRule: head, StartDate: start}, start, until)
+		if err != nil {
+			t.Errorf("%s: head %q: %v", tt.name, head, err)
+			continue
+		}
+		gotTail, err := Expand(models.EventSeries{RRule: tail, StartDate: tt.at}, tt.at, until)
+		if err != nil {
+			t.Errorf("%s: tail %q: %v", tt.name, tail, err)
+			continue
+		}
+		if !slices.Equal(gotHead, tt.wantHead) || !slices.Equal(gotTail, tt.wantTail) {
+			t.Errorf("%s: Split = %q, %q expanding to %v, %v; want %v, %v", tt.name, head, tail, gotHead, gotTail, tt.wantHead, tt.wantTail)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package reminders emails registrants ahead of their events.
+//
+// Each configured offset defines a window: the 1h reminder is due from one
+// hour before the start until the next smaller offset is due (or the event
+// starts). A reminder is claimed by inserting its (registration, offset) row
+// into event_reminders together with a send job, so every reminder is sent
+// at most once however many replicas run the scheduler.
+package reminders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"homework/app/internal/config"
+	"homework/app/internal/jobs"
+	"homework/app/internal/mailer"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const jobSend = "reminder.send"
+
+type Scheduler struct {
+	db       *sqlx.DB
+	mail     mailer.Mailer
+	offsets  []time.Duration
+	interval time.Duration
+}
+
+func NewScheduler(db *sqlx.DB, mail mailer.Mailer, cfg config.RemindersConfig) *Scheduler {
+	offsets := slices.Clone(cfg.Offsets)
+	slices.Sort(offsets)
+	slices.Reverse(offsets)
+	return &Scheduler{db: db, mail: mail, offsets: offsets, interval: cfg.Interval}
+}
+
+// RegisterJobs installs the reminder job handler on runner.
+func (s *Scheduler) RegisterJobs(runner *jobs.Runner) {
+	runner.Register(jobSend, s.send)
+}
+
+// Run schedules due reminders every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ScheduleDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Reminder scheduling failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type sendJob struct {
+	RegistrationID int `json:"registration_id"`
+	OffsetMinutes  int `json:"offset_minutes"`
+}
+
+// ScheduleDue claims every reminder whose window is open and enqueues it.
+func (s *Scheduler) ScheduleDue(ctx context.Context) error {
+	for i, offset := range s.offsets {
+		var until time.Duration
+		if i+1 < len(s.offsets) {
+			until = s.offsets[i+1]
+		}
+		if err := s.scheduleWindow(ctx, offset, until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) scheduleWindow(ctx context.Context, offset, until time.Duration) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	minutes := int(offset.Minutes())
+	var claimed []sendJob
+	query := `INSERT INTO event_reminders (registration_id, offset_minutes)
+		SELECT r.id, $1 FROM registrations r
+		JOIN events e ON e.id = r.event_id
+		LEFT JOIN notification_preferences p ON p.user_id = r.participant_id
+		WHERE r.status = 'confirmed'
+			AND e.status = 'published'
+			AND COALESCE(p.event_reminders, true)
+			AND e.date_event + e.start_time::time - $1 * interval '1 minute' <= now() at time zone 'utc'
+			AND e.date_event + e.start_time::time - $2 * interval '1 minute' > now() at time zone 'utc'
+		ON CONFLICT DO NOTHING
+		RETURNING registration_id, offset_minutes`
+	rows, err := tx.QueryxContext(ctx, query, minutes, int(until.Minutes()))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var job sendJob
+		if err := rows.Scan(&job.RegistrationID, &job.OffsetMinutes); err != nil {
+			rows.Close()
+			return err
+		}
+		claimed = append(claimed, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, job := range claimed {
+		if _, err := jobs.Enqueue(ctx, tx, jobSend, job); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Scheduler) send(ctx context.Context, job jobs.Job) error {
+	var p sendJob
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return err
+	}
+
+	var reminder struct {
+		Email          string    `db:"email"`
+		Username       string    `db:"username"`
+		EventName      string    `db:"name"`
+		Location       string    `db:"location"`
+		StartsAt       time.Time `db:"starts_at"`
+		Status         string    `db:"status"`
+		EventStatus    string    `db:"event_status"`
+		EventReminders bool      `db:"event_reminders"`
+		EmailEnabled   bool      `db:"email_enabled"`
+	}
+	query := `SELECT u.email, u.username, e.name, COALESCE(e.location, '') AS location,
+			e.date_event + e.start_time::time AS starts_at, r.status, e.status AS event_status,
+			COALESCE(p.event_reminders, true) AS event_reminders,
+			COALESCE(p.email_enabled, true) AS email_enabled
+		FROM registrations r
+		JOIN users u ON u.id = r.participant_id
+		JOIN events e ON e.id = r.event_id
+		LEFT JOIN notification_preferences p ON p.user_id = r.participant_id
+		WHERE r.id = $1`
+	err := s.db.GetContext(ctx, &reminder, query, p.RegistrationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Preferences, the registration or the event may have changed since
+	// scheduling.
+	if reminder.Status != "confirmed" || reminder.EventStatus != "published" || !reminder.EventReminders || !reminder.EmailEnabled {
+		return nil
+	}
+
+	return s.mail.Send(ctx, mailer.Message{
+		To:      reminder.Email,
+		Subject: fmt.Sprintf("Reminder: %s starts %s", reminder.EventName, humanizeOffset(p.OffsetMinutes)),
+		Body: fmt.Sprintf("Hi %s,\n\n%s starts at %s UTC%s.\n",
+			reminder.Username, reminder.EventName, reminder.StartsAt.Format("02 Jan 2006 15:04"), locationSuffix(reminder.Location)),
+	})
+}
+
+func humanizeOffset(minutes int) string {
+	switch {
+	case minutes%(24*60) == 0:
+		if days := minutes / (24 * 60); days > 1 {
+			return fmt.Sprintf("in %d days", days)
+		}
+		return "in 1 day"
+	case minutes%60 == 0:
+		return fmt.Sprintf("in %d h", minutes/60)
+	default:
+		return fmt.Sprintf("in %d min", minutes)
+	}
+}
+
+func locationSuffix(location string) string {
+	if location == "" {
+		return ""
+	}
+	return " at " + location
+}
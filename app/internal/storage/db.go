@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"log"
 
 	"homework/app/internal/config"
@@ -9,12 +10,19 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// ExpectedMigrationVersion is the goose version of the newest file in
+// migrations/. Bump it together with every new migration.
+const ExpectedMigrationVersion int64 = 20261019235000
+
 func Connect(cfg *config.Config) *sqlx.DB {
-	db, err := sqlx.Open("postgres", cfg.DatabaseURL)
+	db, err := sqlx.Open("postgres", cfg.Database.URL)
 
 	if err != nil {
 		log.Fatalf("Unable to connect to the database: %v", err)
 	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
 	if err := db.Ping(); err != nil {
 		log.Fatalf("Failed to ping database: %v", err)
 	}
@@ -23,3 +31,13 @@ func Connect(cfg *config.Config) *sqlx.DB {
 
 	return db
 }
+
+// MigrationVersion returns the highest migration version goose has applied.
+func MigrationVersion(ctx context.Context, db *sqlx.DB) (int64, error) {
+	var version int64
+	query := "SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied"
+	if err := db.GetContext(ctx, &version, query); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
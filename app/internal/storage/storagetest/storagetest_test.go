@@ -0,0 +1,36 @@
+package storagetest
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUpSection(t *testing.T) {
+	migration := `--+goose Up
+-- +goose StatementBegin
+create table Things(id bigint);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Things;
+-- +goose StatementEnd
+`
+	up := upSection(migration)
+	if !strings.Contains(up, "create table Things") || strings.Contains(up, "drop table") || strings.Contains(up, "goose") {
+		t.Fatalf("upSection = %q", up)
+	}
+}
+
+func TestEveryMigrationHasAnUpSection(t *testing.T) {
+	for _, file := range migrationFiles(t) {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(upSection(string(body))) == "" {
+			t.Errorf("%s has no statements to apply", file)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package tickets issues and verifies tamper-proof ticket codes.
+//
+// A code has the form "T1.<registration>.<event>.<nonce>.<signature>" where
+// the signature is a truncated HMAC-SHA256 over everything before it. The
+// nonce is stored on the registration; replacing it revokes earlier codes.
+// Guests named on a group registration get codes of the form
+// "G1.<registration>.<guest>.<event>.<nonce>.<signature>", with the nonce
+// stored on the guest.
+package tickets
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"homework/app/internal/config"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	version        = "T1"
+	guestVersion   = "G1"
+	signatureBytes = 16
+	qrSize         = 320
+)
+
+var ErrInvalidCode = errors.New("invalid ticket code")
+
+var signingKey []byte
+
+// Configure sets the signing key. Without a dedicated ticket key one is
+// derived from the token signing key. It must be called once at startup.
+func Configure(cfg config.TicketsConfig, auth config.AuthConfig) {
+	if cfg.SigningKey != "" {
+		signingKey = []byte(cfg.SigningKey)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(auth.SigningKey))
+	mac.Write([]byte("tickets"))
+	signingKey = mac.Sum(nil)
+}
+
+// Ticket identifies the holder of a seat. GuestID is zero for the
+// participant who registered.
+type Ticket struct {
+	RegistrationID int
+	GuestID        int
+	EventID        int
+	Nonce          string
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureBytes])
+}
+
+func Code(t Ticket) string {
+	payload := fmt.Sprintf("%s.%d.%d.%s", version, t.RegistrationID, t.EventID, t.Nonce)
+	if t.GuestID != 0 {
+		payload = fmt.Sprintf("%s.%d.%d.%d.%s", guestVersion, t.RegistrationID, t.GuestID, t.EventID, t.Nonce)
+	}
+	return payload + "." + sign(payload)
+}
+
+// Parse verifies a code's signature and returns the ticket it encodes. The
+// caller must still compare the nonce against the registration.
+func Parse(code string) (Ticket, error) {
+	code = strings.TrimSpace(code)
+	i := strings.LastIndexByte(code, '.')
+	if i < 0 {
+		return Ticket{}, ErrInvalidCode
+	}
+	payload, signature := code[:i], code[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(sign(payload))) {
+		return Ticket{}, ErrInvalidCode
+	}
+
+	parts := strings.Split(payload, ".")
+	var ids []string
+	switch {
+	case len(parts) == 4 && parts[0] == version:
+		ids = []string{parts[1], "0", parts[2]}
+	case len(parts) == 5 && parts[0] == guestVersion:
+		ids = parts[1:4]
+	default:
+		return Ticket{}, ErrInvalidCode
+	}
+	registrationID, err1 := strconv.Atoi(ids[0])
+	guestID, err2 := strconv.Atoi(ids[1])
+	eventID, err3 := strconv.Atoi(ids[2])
+	if err1 != nil || err2 != nil || err3 != nil || (parts[0] == guestVersion && guestID < 1) {
+		return Ticket{}, ErrInvalidCode
+	}
+	return Ticket{RegistrationID: registrationID, GuestID: guestID, EventID: eventID, Nonce: parts[len(parts)-1]}, nil
+}
+
+// QRCode renders the ticket's code as a PNG.
+func QRCode(t Ticket) ([]byte, error) {
+	return qrcode.Encode(Code(t), qrcode.Medium, qrSize)
+}
@@ -0,0 +1,79 @@
+package tickets
+
+import (
+	"homework/app/internal/config"
+	"strings"
+	"testing"
+)
+
+func init() {
+	Configure(config.TicketsConfig{SigningKey: "ticket-key"}, config.AuthConfig{})
+}
+
+func TestCodeRoundTrips(t *testing.T) {
+	for _, ticket := range []Ticket{
+		{RegistrationID: 7, EventID: 42, Nonce: "abc"},
+		{RegistrationID: 7, GuestID: 3, EventID: 42, Nonce: "abc"},
+	} {
+		got, err := Parse(" " + Code(ticket) + "\n")
+		if err != nil || got != ticket {
+			t.Errorf("Parse(Code(%+v)) = %+v, %v", ticket, got, err)
+		}
+	}
+}
+
+func TestParseRejectsTamperedCodes(t *testing.T) {
+	ticket := Code(Ticket{RegistrationID: 7, EventID: 42, Nonce: "abc"})
+	guest := Code(Ticket{RegistrationID: 7, GuestID: 3, EventID: 42, Nonce: "abc"})
+	for _, code := range []string{
+		"",
+		"garbage",
+		strings.Replace(ticket, ".42.", ".43.", 1),
+		strings.Replace(ticket, "T1.", "G1.", 1),
+		strings.Replace(guest, ".3.", ".4.", 1),
+		strings.Replace(guest, "G1.", "T1.", 1),
+		ticket[:len(ticket)-1],
+		ticket + "x",
+		// Signed, but not a ticket this version issues.
+		"T1.7.42." + sign("T1.7.42"),
+		"G1.7.0.42.abc." + sign("G1.7.0.42.abc"),
+		"T1.x.42.abc." + sign("T1.x.42.abc"),
+	} {
+		if _, err := Parse(code); err != ErrInvalidCode {
+			t.Errorf("Parse(%q) = %v, want ErrInvalidCode", code, err)
+		}
+	}
+}
+
+func TestConfigureSigningKeys(t *testing.T) {
+	defer Configure(config.TicketsConfig{SigningKey: "ticket-key"}, config.AuthConfig{})
+	ticket := Ticket{RegistrationID: 7, EventID: 42, Nonce: "abc"}
+
+	issued := Code(ticket)
+	Configure(config.TicketsConfig{SigningKey: "another-key"}, config.AuthConfig{})
+	if _, err := Parse(issued); err != ErrInvalidCode {
+		t.Errorf("code signed with a different key: err = %v, want ErrInvalidCode", err)
+	}
+
+	// Without a ticket key, one is derived from the token signing key, and
+	// differs from it.
+	Configure(config.TicketsConfig{}, config.AuthConfig{SigningKey: "auth-key"})
+	derived := Code(ticket)
+	if _, err := Parse(derived); err != nil {
+		t.Errorf("Parse with a derived key: %v", err)
+	}
+	Configure(config.TicketsConfig{SigningKey: "auth-key"}, config.AuthConfig{})
+	if _, err := Parse(derived); err != ErrInvalidCode {
+		t.Errorf("derived key equals the token signing key")
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	png, err := QRCode(Ticket{RegistrationID: 7, EventID: 42, Nonce: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(png), "\x89PNG") {
+		t.Errorf("QRCode did not return a PNG")
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// API keys are "ak_" followed by 32 random bytes. They carry enough entropy
+// that an unsalted SHA-256 is safe to store in place of the key.
+const (
+	apiKeyTag       = "ak_"
+	APIKeyPrefixLen = 10
+)
+
+func NewAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyTag + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
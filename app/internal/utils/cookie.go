@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+
+	"homework/app/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+var cookieConfig config.CookieConfig
+
+// ConfigureCookies sets the attributes used for the session and CSRF cookies.
+// It must be called once at startup.
+func ConfigureCookies(cfg config.CookieConfig) {
+	cookieConfig = cfg
+}
+
+func CookieSettings() config.CookieConfig {
+	return cookieConfig
+}
+
+func sameSite() http.SameSite {
+	switch strings.ToLower(cookieConfig.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+func setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	c.SetSameSite(sameSite())
+	c.SetCookie(name, value, maxAge, cookieConfig.Path, cookieConfig.Domain, cookieConfig.Secure, httpOnly)
+}
+
+// SetAuthCookie stores the session token for as long as the token is valid.
+func SetAuthCookie(c *gin.Context, token string) {
+	setCookie(c, cookieConfig.Name, token, int(tokenConfig.TokenTTL.Seconds()), true)
+}
+
+func ClearAuthCookie(c *gin.Context) {
+	setCookie(c, cookieConfig.Name, "", -1, true)
+}
+
+// SetCSRFCookie is deliberately not HttpOnly: the client has to read it to
+// send the value back in the CSRF header.
+func SetCSRFCookie(c *gin.Context, token string) {
+	setCookie(c, cookieConfig.CSRFCookieName, token, 0, false)
+}
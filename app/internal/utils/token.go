@@ -2,42 +2,57 @@ package utils
 
 import (
 	"fmt"
-	"os"
 	"time"
 
+	"homework/app/internal/config"
+
 	"github.com/golang-jwt/jwt/v4"
 )
 
+var tokenConfig config.AuthConfig
+
+// ConfigureTokens sets the keys and lifetime used by CreateToken and
+// VerifyToken. It must be called once at startup.
+func ConfigureTokens(cfg config.AuthConfig) {
+	tokenConfig = cfg
+}
+
 func CreateToken(username string) (string, error) {
 	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": username,
 		"iss": "homework",
-		"exp": time.Now().Add(time.Hour).Unix(),
+		"exp": time.Now().Add(tokenConfig.TokenTTL).Unix(),
 		"iat": time.Now().Unix(),
 	})
 
-	tokenString, err := claims.SignedString([]byte(os.Getenv("SIGNING_KEY")))
+	tokenString, err := claims.SignedString([]byte(tokenConfig.SigningKey))
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
-	fmt.Printf("Token claims added: %+v\n", claims)
 	return tokenString, nil
 }
 
 func VerifyToken(tokenString string) (*jwt.Token, error) {
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("SIGNING_KEY")), nil
-	})
-
-	if err != nil {
-		return nil, err
+	keys := append([]string{tokenConfig.SigningKey}, tokenConfig.PreviousSigningKeys...)
+
+	var lastErr error
+	for _, key := range keys {
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+			return []byte(key), nil
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !token.Valid {
+			return nil, fmt.Errorf("invalid token")
+		}
+		return token, nil
 	}
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	return token, nil
 
+	return nil, lastErr
 }
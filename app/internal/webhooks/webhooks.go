@@ -0,0 +1,350 @@
+// Package webhooks delivers signed lifecycle notifications to endpoints
+// registered by organizers.
+//
+// Publish enqueues a job in the caller's transaction. When it runs, the job
+// records one delivery per matching webhook and enqueues a delivery job for
+// each; the job runner retries failed deliveries with exponential backoff.
+// Every attempt's outcome is kept in webhook_deliveries.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"homework/app/internal/config"
+	"homework/app/internal/jobs"
+	"homework/app/internal/models"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	EventRegistrationCreated   = "registration.created"
+	EventRegistrationCancelled = "registration.cancelled"
+	EventEventCreated          = "event.created"
+	EventEventUpdated          = "event.updated"
+	EventEventPublished        = "event.published"
+)
+
+// ErrForbiddenAddress is returned for webhook URLs, and deliveries, that
+// would reach a loopback, private or otherwise non-public address.
+var ErrForbiddenAddress = errors.New("webhook endpoints must be publicly routable")
+
+// EventTypes lists every event type a webhook can subscribe to.
+var EventTypes = []string{
+	EventRegistrationCreated,
+	EventRegistrationCancelled,
+	EventEventCreated,
+	EventEventUpdated,
+	EventEventPublished,
+}
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+
+	jobPublish = "webhook.publish"
+	jobDeliver = "webhook.deliver"
+)
+
+func IsEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body" under secret.
+// Receivers recompute it from the X-Webhook-Timestamp header and the raw
+// request body and compare against X-Webhook-Signature ("sha256=<hex>").
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	expected := "sha256=" + Sign(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+type envelope struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type publishJob struct {
+	OwnerID   int             `json:"owner_id"`
+	EventType string          `json:"event_type"`
+	Body      json.RawMessage `json:"body"`
+}
+
+type deliverJob struct {
+	DeliveryID int `json:"delivery_id"`
+}
+
+// Publish schedules eventType for every active webhook of ownerID subscribed
+// to it. Pass the transaction carrying the change being announced as ext.
+func Publish(ctx context.Context, ext sqlx.ExtContext, ownerID int, eventType string, data any) error {
+	body, err := json.Marshal(envelope{Type: eventType, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+	_, err = jobs.Enqueue(ctx, ext, jobPublish, publishJob{OwnerID: ownerID, EventType: eventType, Body: body})
+	return err
+}
+
+// PublishToOrganizers is Publish for everyone managing eventID, that is
+// holding the editor or owner role on it.
+func PublishToOrganizers(ctx context.Context, ext sqlx.ExtContext, eventID int, eventType string, data any) error {
+	var organizers []int
+	query := "SELECT user_id FROM event_organizers WHERE event_id = $1 AND role IN ('editor', 'owner') ORDER BY user_id"
+	if err := sqlx.SelectContext(ctx, ext, &organizers, query, eventID); err != nil {
+		return err
+	}
+	for _, organizerID := range organizers {
+		if err := Publish(ctx, ext, organizerID, eventType, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Dispatcher struct {
+	db          *sqlx.DB
+	client      *http.Client
+	maxAttempts int
+}
+
+func NewDispatcher(db *sqlx.DB, cfg config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		client:      &http.Client{Timeout: cfg.Timeout, Transport: publicTransport()},
+		maxAttempts: cfg.MaxAttempts,
+	}
+}
+
+// publicTransport dials public addresses only. The check runs on the address
+// actually dialed, so DNS answers that change after ValidateURL, and
+// redirects, cannot reach internal services either.
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is routable on the internet, as opposed to
+// loopback, private, link-local (cloud metadata services live there) and
+// similar ranges.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// ValidateURL checks that rawURL is an absolute http(s) URL whose host only
+// resolves to public addresses.
+func ValidateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("webhook URL must be an absolute http(s) URL")
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// WithClient replaces the HTTP client, e.g. with an httptest server's client.
+func (d *Dispatcher) WithClient(client *http.Client) *Dispatcher {
+	d.client = client
+	return d
+}
+
+// Redeliver queues a fresh copy of an earlier delivery, leaving the original
+// record untouched.
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryID int) (int, error) {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_type, payload, redelivery_of)
+		SELECT webhook_id, event_type, payload, id FROM webhook_deliveries WHERE id = $1
+		RETURNING id`
+	if err := tx.GetContext(ctx, &id, query, deliveryID); err != nil {
+		return 0, err
+	}
+	if _, err := jobs.Enqueue(ctx, tx, jobDeliver, deliverJob{DeliveryID: id}, jobs.MaxAttempts(d.maxAttempts)); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// RegisterJobs installs the dispatcher's job handlers on runner.
+func (d *Dispatcher) RegisterJobs(runner *jobs.Runner) {
+	runner.Register(jobPublish, d.fanOut)
+	runner.Register(jobDeliver, d.deliverJob)
+}
+
+// fanOut turns a published event into one delivery per subscribed webhook.
+func (d *Dispatcher) fanOut(ctx context.Context, job jobs.Job) error {
+	var p publishJob
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ids []int
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+		SELECT id, $2, $3 FROM webhooks
+		WHERE owner_id = $1 AND active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+		RETURNING id`
+	if err := tx.SelectContext(ctx, &ids, query, p.OwnerID, p.EventType, []byte(p.Body)); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := jobs.Enqueue(ctx, tx, jobDeliver, deliverJob{DeliveryID: id}, jobs.MaxAttempts(d.maxAttempts)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *Dispatcher) deliverJob(ctx context.Context, job jobs.Job) error {
+	var p deliverJob
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return err
+	}
+
+	var delivery struct {
+		models.WebhookDelivery
+		URL    string `db:"url"`
+		Secret string `db:"secret"`
+	}
+	query := `SELECT d.*, w.url, w.secret FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.id = $1`
+	if err := d.db.GetContext(ctx, &delivery, query, p.DeliveryID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The webhook was deleted in the meantime.
+			return nil
+		}
+		return err
+	}
+	if delivery.Status != StatusPending {
+		return nil
+	}
+
+	status, err := d.Deliver(ctx, delivery.URL, delivery.Secret, delivery.WebhookDelivery)
+
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+
+	switch {
+	case err == nil:
+		query = `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_status = $2, last_error = NULL, delivered_at = now() WHERE id = $3`
+		_, dbErr := d.db.ExecContext(ctx, query, StatusSucceeded, responseStatus, delivery.ID)
+		return dbErr
+	case job.LastAttempt():
+		query = `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_status = $2, last_error = $3 WHERE id = $4`
+		_, dbErr := d.db.ExecContext(ctx, query, StatusFailed, responseStatus, err.Error(), delivery.ID)
+		if dbErr != nil {
+			log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, dbErr)
+		}
+	default:
+		query = `UPDATE webhook_deliveries SET attempts = attempts + 1, response_status = $1, last_error = $2 WHERE id = $3`
+		if _, dbErr := d.db.ExecContext(ctx, query, responseStatus, err.Error(), delivery.ID); dbErr != nil {
+			log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, dbErr)
+		}
+	}
+	return err
+}
+
+// Deliver posts one signed delivery and returns the response status code.
+// Any non-2xx response is an error.
+func (d *Dispatcher) Deliver(ctx context.Context, url, secret string, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "homework-webhooks/1")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,240 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"homework/app/internal/config"
+	"homework/app/internal/jobs"
+	"homework/app/internal/models"
+	"homework/app/internal/storage/storagetest"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+)
+
+func TestDeliverSignsRequest(t *testing.T) {
+	const secret = "s3cret"
+	var received atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if err != nil {
+			t.Errorf("timestamp header: %v", err)
+		}
+		if !Verify(secret, timestamp, body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("signature %q does not verify", r.Header.Get(SignatureHeader))
+		}
+		if got := r.Header.Get(EventHeader); got != EventEventCreated {
+			t.Errorf("event header = %q, want %q", got, EventEventCreated)
+		}
+		if got := r.Header.Get(DeliveryHeader); got != "42" {
+			t.Errorf("delivery header = %q, want 42", got)
+		}
+		received.Store(true)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d := (&Dispatcher{}).WithClient(server.Client())
+	delivery := models.WebhookDelivery{ID: 42, EventType: EventEventCreated, Payload: types.JSONText(`{"type":"event.created"}`)}
+	status, err := d.Deliver(context.Background(), server.URL, secret, delivery)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("Deliver = %d, %v; want 204, nil", status, err)
+	}
+	if !received.Load() {
+		t.Fatal("receiver was not called")
+	}
+}
+
+func TestDeliverFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	d := (&Dispatcher{}).WithClient(server.Client())
+	status, err := d.Deliver(context.Background(), server.URL, "secret", models.WebhookDelivery{Payload: types.JSONText(`{}`)})
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("Deliver = %d, %v; want 503 and an error", status, err)
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	var called atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil, config.WebhooksConfig{MaxAttempts: 1, Timeout: time.Second})
+	_, err := d.Deliver(context.Background(), server.URL, "secret", models.WebhookDelivery{Payload: types.JSONText(`{}`)})
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("Deliver to %s: err = %v, want ErrForbiddenAddress", server.URL, err)
+	}
+	if called.Load() {
+		t.Fatal("request reached a loopback receiver")
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://[2606:4700::1111]/hook", true},
+		{"ftp://93.184.216.34/hook", false},
+		{"/relative", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://172.16.0.1/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+		{"http://[fd00::1]/hook", false},
+	}
+	for _, tt := range tests {
+		err := ValidateURL(context.Background(), tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateURL(%q) = %v, want ok = %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for _, addr := range []string{"8.8.8.8", "1.1.1.1", "2001:4860:4860::8888"} {
+		if !publicIP(net.ParseIP(addr)) {
+			t.Errorf("publicIP(%s) = false, want true", addr)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1", "10.0.0.1", "169.254.169.254", "100.127.255.255", "::1", "fe80::1", "224.0.0.1"} {
+		if publicIP(net.ParseIP(addr)) {
+			t.Errorf("publicIP(%s) = true, want false", addr)
+		}
+	}
+}
+
+// deliveryRecord is the part of a delivery the log shows.
+type deliveryRecord struct {
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	ResponseStatus *int       `db:"response_status"`
+	LastError      *string    `db:"last_error"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+}
+
+// publishAndRun publishes an event to a webhook of a new user pointing at
+// receiver and runs the job runner until the delivery stops being pending.
+func publishAndRun(t *testing.T, db *sqlx.DB, receiver *httptest.Server, maxAttempts int) deliveryRecord {
+	t.Helper()
+	ctx := context.Background()
+
+	var ownerID int
+	query := "INSERT INTO users (username, email, password_hash) VALUES ('owner', 'owner@example.com', '') RETURNING id"
+	if err := db.Get(&ownerID, query); err != nil {
+		t.Fatal(err)
+	}
+	// Inserted directly: the receiver listens on loopback, which ValidateURL
+	// would refuse.
+	query = "INSERT INTO webhooks (owner_id, url, secret) VALUES ($1, $2, 'secret')"
+	if _, err := db.Exec(query, ownerID, receiver.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	jobsConfig := config.JobsConfig{Workers: 1, PollInterval: 10 * time.Millisecond, JobTimeout: 5 * time.Second,
+		MaxAttempts: maxAttempts, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	jobs.Configure(jobsConfig)
+	runner := jobs.NewRunner(db, jobsConfig)
+	d := NewDispatcher(db, config.WebhooksConfig{MaxAttempts: maxAttempts, Timeout: time.Second}).WithClient(receiver.Client())
+	d.RegisterJobs(runner)
+
+	if err := Publish(ctx, db, ownerID, EventEventCreated, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		runner.Run(runCtx)
+		close(done)
+	}()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	var record deliveryRecord
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		err := db.Get(&record, "SELECT status, attempts, response_status, last_error, delivered_at FROM webhook_deliveries")
+		if err == nil && record.Status != StatusPending {
+			return record
+		}
+	}
+	t.Fatalf("delivery still pending: %+v", record)
+	return record
+}
+
+func TestDeliveryIsRetriedAndLogged(t *testing.T) {
+	db := storagetest.New(t)
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	record := publishAndRun(t, db, receiver, 5)
+	if record.Status != StatusSucceeded || record.Attempts != 3 {
+		t.Fatalf("delivery = %s after %d attempts, want succeeded after 3", record.Status, record.Attempts)
+	}
+	if record.ResponseStatus == nil || *record.ResponseStatus != http.StatusOK {
+		t.Errorf("response_status = %v, want 200", record.ResponseStatus)
+	}
+	if record.LastError != nil {
+		t.Errorf("last_error = %q, want none after success", *record.LastError)
+	}
+	if record.DeliveredAt == nil {
+		t.Error("delivered_at not set")
+	}
+}
+
+func TestDeliveryFailsAfterLastAttempt(t *testing.T) {
+	db := storagetest.New(t)
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	record := publishAndRun(t, db, receiver, 2)
+	if record.Status != StatusFailed || record.Attempts != 2 || calls.Load() != 2 {
+		t.Fatalf("delivery = %s after %d attempts and %d calls, want failed after 2", record.Status, record.Attempts, calls.Load())
+	}
+	if record.ResponseStatus == nil || *record.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("response_status = %v, want 500", record.ResponseStatus)
+	}
+	if record.LastError == nil {
+		t.Error("last_error not recorded")
+	}
+	if record.DeliveredAt != nil {
+		t.Error("delivered_at set for a failed delivery")
+	}
+}
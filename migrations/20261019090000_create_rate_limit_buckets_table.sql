@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+create table rate_limit_buckets(
+    key text primary key,
+    tokens double precision not null,
+    updated_at timestamptz not null default now()
+);
+create index rate_limit_buckets_updated_at_idx on rate_limit_buckets(updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table rate_limit_buckets;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table Registrations
+    add column status varchar(32) not null default 'confirmed',
+    add column cancelled_at timestamp;
+create unique index registrations_active_participant_idx
+    on Registrations(event_id, participant_id) where status <> 'cancelled';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index registrations_active_participant_idx;
+alter table Registrations
+    drop column cancelled_at,
+    drop column status;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+create table Webhooks(
+    id bigint primary key generated by default as identity,
+    owner_id bigint not null,
+    url text not null,
+    secret varchar(64) not null,
+    event_types text[] not null default '{}',
+    active boolean not null default true,
+    created_at timestamp(0) not null default(now() at time zone 'utc'),
+    foreign key (owner_id) references Users(id) on delete cascade
+);
+
+create table Webhook_Deliveries(
+    id bigint primary key generated by default as identity,
+    webhook_id bigint not null,
+    event_type varchar(64) not null,
+    payload jsonb not null,
+    status varchar(16) not null default 'pending',
+    attempts int not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    response_status int,
+    last_error text,
+    redelivery_of bigint,
+    created_at timestamptz not null default now(),
+    delivered_at timestamptz,
+    foreign key (webhook_id) references Webhooks(id) on delete cascade,
+    foreign key (redelivery_of) references Webhook_Deliveries(id) on delete set null
+);
+create index webhook_deliveries_due_idx on Webhook_Deliveries(next_attempt_at) where status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Webhook_Deliveries;
+drop table Webhooks;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+create table Jobs(
+    id bigint primary key generated by default as identity,
+    kind varchar(64) not null,
+    payload jsonb not null,
+    status varchar(16) not null default 'pending',
+    attempts int not null default 0,
+    max_attempts int not null,
+    run_at timestamptz not null default now(),
+    locked_until timestamptz,
+    last_error text,
+    created_at timestamptz not null default now(),
+    finished_at timestamptz
+);
+create index jobs_pending_idx on Jobs(run_at) where status = 'pending';
+create index jobs_running_idx on Jobs(locked_until) where status = 'running';
+create index jobs_dead_idx on Jobs(kind) where status = 'dead';
+
+-- Delivery retries are scheduled as jobs now.
+drop index webhook_deliveries_due_idx;
+alter table Webhook_Deliveries drop column next_attempt_at;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table Webhook_Deliveries add column next_attempt_at timestamptz not null default now();
+create index webhook_deliveries_due_idx on Webhook_Deliveries(next_attempt_at) where status = 'pending';
+drop table Jobs;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+create table Notification_Preferences(
+    user_id bigint primary key,
+    event_reminders boolean not null default true,
+    email_enabled boolean not null default true,
+    updated_at timestamptz not null default now(),
+    foreign key (user_id) references Users(id) on delete cascade
+);
+
+create table Event_Reminders(
+    registration_id bigint not null,
+    offset_minutes int not null,
+    created_at timestamptz not null default now(),
+    primary key (registration_id, offset_minutes),
+    foreign key (registration_id) references Registrations(id) on delete cascade
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Event_Reminders;
+drop table Notification_Preferences;
+-- +goose StatementEnd
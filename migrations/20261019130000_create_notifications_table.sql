@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table Events add column capacity int check (capacity > 0);
+
+create table Notifications(
+    id bigint primary key generated by default as identity,
+    user_id bigint not null,
+    kind varchar(64) not null,
+    title varchar(255) not null,
+    body text not null default '',
+    event_id bigint,
+    read_at timestamptz,
+    created_at timestamptz not null default now(),
+    foreign key (user_id) references Users(id) on delete cascade,
+    foreign key (event_id) references Events(id) on delete cascade
+);
+create index notifications_user_idx on Notifications(user_id, id desc);
+create index notifications_unread_idx on Notifications(user_id) where read_at is null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Notifications;
+alter table Events drop column capacity;
+-- +goose StatementEnd
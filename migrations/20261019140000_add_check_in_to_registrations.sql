@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table Registrations
+    add column ticket_nonce varchar(32) not null default md5(random()::text || clock_timestamp()::text),
+    add column checked_in_at timestamp,
+    add column checked_in_by bigint references Users(id) on delete set null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table Registrations
+    drop column checked_in_by,
+    drop column checked_in_at,
+    drop column ticket_nonce;
+-- +goose StatementEnd
@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+create table Event_series(
+    id bigint primary key generated by default as identity,
+    name varchar(255) not null,
+    description citext,
+    location citext,
+    start_time timestamp not null,
+    end_time timestamp not null,
+    start_date date not null,
+    rrule text not null,
+    capacity int check (capacity > 0),
+    created_by bigint not null,
+    materialized_until date not null,
+    created_at timestamptz not null default now(),
+    foreign key (created_by) references Users(id) on delete cascade
+);
+create index event_series_horizon_idx on Event_series(materialized_until);
+
+create table Event_series_exdates(
+    series_id bigint not null references Event_series(id) on delete cascade,
+    exdate date not null,
+    primary key (series_id, exdate)
+);
+
+alter table Events
+    add column series_id bigint references Event_series(id) on delete set null,
+    add column occurrence_date date,
+    add column detached boolean not null default false,
+    add column cancelled_at timestamptz;
+create unique index events_series_occurrence_idx on Events(series_id, occurrence_date);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table Events
+    drop column cancelled_at,
+    drop column detached,
+    drop column occurrence_date,
+    drop column series_id;
+drop table Event_series_exdates;
+drop table Event_series;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+create table Ticket_types(
+    id bigint primary key generated by default as identity,
+    event_id bigint not null,
+    name varchar(255) not null,
+    price bigint not null default 0 check (price >= 0),
+    currency char(3) not null,
+    quantity int not null check (quantity > 0),
+    sold int not null default 0 check (sold >= 0 and sold <= quantity),
+    sales_start timestamptz,
+    sales_end timestamptz,
+    min_per_order int not null default 1 check (min_per_order > 0),
+    max_per_order int check (max_per_order >= min_per_order),
+    created_at timestamptz not null default now(),
+    foreign key (event_id) references Events(id) on delete cascade,
+    unique (event_id, name)
+);
+
+alter table Registrations
+    add column ticket_type_id bigint references Ticket_types(id) on delete restrict,
+    add column quantity int not null default 1 check (quantity > 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table Registrations
+    drop column quantity,
+    drop column ticket_type_id;
+drop table Ticket_types;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table Registrations
+    add column amount bigint not null default 0 check (amount >= 0),
+    add column currency varchar(3) not null default '',
+    add column payment_provider varchar(32),
+    add column checkout_id varchar(255) unique,
+    add column checkout_url text,
+    add column payment_id varchar(255),
+    add column hold_expires_at timestamptz,
+    add column paid_at timestamptz;
+
+-- Expired holds no longer block registering again.
+drop index registrations_active_participant_idx;
+create unique index registrations_active_participant_idx
+    on Registrations(event_id, participant_id) where status not in ('cancelled', 'expired');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index registrations_active_participant_idx;
+create unique index registrations_active_participant_idx
+    on Registrations(event_id, participant_id) where status <> 'cancelled';
+alter table Registrations
+    drop column paid_at,
+    drop column hold_expires_at,
+    drop column payment_id,
+    drop column checkout_url,
+    drop column checkout_id,
+    drop column payment_provider,
+    drop column currency,
+    drop column amount;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+create table Promo_codes(
+    id bigint primary key generated by default as identity,
+    event_id bigint not null,
+    code citext not null,
+    kind varchar(16) not null check (kind in ('percentage', 'fixed')),
+    amount bigint not null check (amount > 0),
+    currency char(3),
+    max_uses int check (max_uses > 0),
+    per_user_limit int check (per_user_limit > 0),
+    valid_from timestamptz,
+    valid_until timestamptz,
+    created_at timestamptz not null default now(),
+    foreign key (event_id) references Events(id) on delete cascade,
+    unique (event_id, code),
+    check (kind <> 'percentage' or amount <= 100),
+    check (kind <> 'fixed' or currency is not null)
+);
+
+-- A code without rows here applies to every ticket type of its event.
+create table Promo_code_ticket_types(
+    promo_code_id bigint not null references Promo_codes(id) on delete cascade,
+    ticket_type_id bigint not null references Ticket_types(id) on delete cascade,
+    primary key (promo_code_id, ticket_type_id)
+);
+
+alter table Registrations
+    add column promo_code_id bigint references Promo_codes(id) on delete set null,
+    add column discount bigint not null default 0 check (discount >= 0);
+create index registrations_promo_code_idx on Registrations(promo_code_id) where promo_code_id is not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table Registrations
+    drop column discount,
+    drop column promo_code_id;
+drop table Promo_code_ticket_types;
+drop table Promo_codes;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Cancelling at least full_refund_days before the event refunds everything,
+-- at least partial_refund_days before refunds partial_refund_percent, and
+-- later refunds nothing. Events without a policy refund in full.
+create table Refund_policies(
+    event_id bigint primary key references Events(id) on delete cascade,
+    full_refund_days int not null check (full_refund_days >= 0),
+    partial_refund_days int not null check (partial_refund_days >= 0),
+    partial_refund_percent int not null check (partial_refund_percent between 0 and 100),
+    updated_at timestamptz not null default now(),
+    check (partial_refund_days <= full_refund_days)
+);
+
+alter table Registrations
+    add column refund_amount bigint not null default 0 check (refund_amount >= 0),
+    add column refund_id varchar(255),
+    add column refunded_at timestamptz;
+
+-- Every payment received and refund issued, append-only. It keeps no foreign
+-- keys so the record outlives deleted events and registrations.
+create table Payment_ledger(
+    id bigint primary key generated by default as identity,
+    registration_id bigint not null,
+    event_id bigint not null,
+    kind varchar(16) not null check (kind in ('payment', 'refund')),
+    amount bigint not null check (amount >= 0),
+    currency char(3) not null,
+    provider varchar(32) not null,
+    reference varchar(255) not null,
+    note text not null default '',
+    created_at timestamptz not null default now(),
+    unique (provider, kind, reference)
+);
+create index payment_ledger_event_idx on Payment_ledger(event_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Payment_ledger;
+alter table Registrations
+    drop column refunded_at,
+    drop column refund_id,
+    drop column refund_amount;
+drop table Refund_policies;
+-- +goose StatementEnd
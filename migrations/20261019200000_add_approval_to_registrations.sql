@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table Events
+    add column requires_approval boolean not null default false;
+alter table Event_series
+    add column requires_approval boolean not null default false;
+
+alter table Registrations
+    add column reviewed_at timestamptz,
+    add column reviewed_by bigint references Users(id) on delete set null,
+    add column review_reason text;
+create index registrations_pending_idx on Registrations(event_id, id) where status = 'pending';
+
+-- A rejected applicant may apply again.
+drop index registrations_active_participant_idx;
+create unique index registrations_active_participant_idx
+    on Registrations(event_id, participant_id) where status not in ('cancelled', 'expired', 'rejected');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index registrations_active_participant_idx;
+create unique index registrations_active_participant_idx
+    on Registrations(event_id, participant_id) where status not in ('cancelled', 'expired');
+drop index registrations_pending_idx;
+alter table Registrations
+    drop column review_reason,
+    drop column reviewed_by,
+    drop column reviewed_at;
+alter table Event_series
+    drop column requires_approval;
+alter table Events
+    drop column requires_approval;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+create table Registration_questions(
+    id bigint primary key generated by default as identity,
+    event_id bigint not null references Events(id) on delete cascade,
+    label varchar(255) not null,
+    kind varchar(16) not null check (kind in ('text', 'single_choice', 'multi_choice', 'number', 'checkbox')),
+    required boolean not null default false,
+    options text[] not null default '{}',
+    position int not null default 0,
+    created_at timestamptz not null default now(),
+    check ((kind in ('single_choice', 'multi_choice')) = (cardinality(options) > 0))
+);
+create index registration_questions_event_idx on Registration_questions(event_id, position, id);
+
+-- value holds the answer as JSON: a string, a number, a boolean or an
+-- array of strings, depending on the question's kind.
+create table Registration_answers(
+    registration_id bigint not null references Registrations(id) on delete cascade,
+    question_id bigint not null references Registration_questions(id) on delete cascade,
+    value jsonb not null,
+    primary key (registration_id, question_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Registration_answers;
+drop table Registration_questions;
+-- +goose StatementEnd
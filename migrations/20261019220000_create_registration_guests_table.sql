@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Guests fill the seats of a registration beyond the participant's own;
+-- each carries its own ticket nonce and check-in.
+create table Registration_guests(
+    id bigint primary key generated by default as identity,
+    registration_id bigint not null references Registrations(id) on delete cascade,
+    name varchar(255) not null,
+    email citext not null,
+    ticket_nonce varchar(32) not null default md5(random()::text || clock_timestamp()::text),
+    checked_in_at timestamp,
+    checked_in_by bigint references Users(id) on delete set null,
+    created_at timestamptz not null default now()
+);
+create index registration_guests_registration_idx on Registration_guests(registration_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Registration_guests;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table Events
+    add column transfers_enabled boolean not null default true;
+alter table Event_series
+    add column transfers_enabled boolean not null default true;
+
+-- A transfer offers a registration to another user, named by username or
+-- email; the registration changes hands once the recipient accepts. Rows
+-- are kept as the registration's transfer history.
+create table Registration_transfers(
+    id bigint primary key generated by default as identity,
+    registration_id bigint not null references Registrations(id) on delete cascade,
+    from_user_id bigint not null references Users(id) on delete cascade,
+    to_user_id bigint references Users(id) on delete cascade,
+    to_email citext,
+    status varchar(16) not null default 'pending' check (status in ('pending', 'accepted', 'declined', 'cancelled')),
+    created_at timestamptz not null default now(),
+    resolved_at timestamptz,
+    check (to_user_id is not null or to_email is not null)
+);
+create unique index registration_transfers_pending_idx on Registration_transfers(registration_id) where status = 'pending';
+create index registration_transfers_to_user_idx on Registration_transfers(to_user_id) where status = 'pending';
+create index registration_transfers_to_email_idx on Registration_transfers(to_email) where status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Registration_transfers;
+alter table Event_series
+    drop column transfers_enabled;
+alter table Events
+    drop column transfers_enabled;
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table Events
+    add column visibility varchar(16) not null default 'public' check (visibility in ('public', 'unlisted', 'private'));
+alter table Event_series
+    add column visibility varchar(16) not null default 'public' check (visibility in ('public', 'unlisted', 'private'));
+
+-- An invite link lets whoever holds its signed code see and register for a
+-- private event. The nonce is part of the code; revoking the link or
+-- passing expires_at or max_uses stops it working.
+create table Event_invite_links(
+    id bigint primary key generated by default as identity,
+    event_id bigint not null references Events(id) on delete cascade,
+    nonce text not null default md5(random()::text || clock_timestamp()::text),
+    expires_at timestamptz,
+    max_uses integer check (max_uses > 0),
+    uses integer not null default 0,
+    created_by bigint not null references Users(id) on delete cascade,
+    created_at timestamptz not null default now(),
+    revoked_at timestamptz
+);
+create index event_invite_links_event_idx on Event_invite_links(event_id);
+
+-- An invite admits the user with that email to a private event without a
+-- link. The email need not belong to an account yet.
+create table Event_invites(
+    id bigint primary key generated by default as identity,
+    event_id bigint not null references Events(id) on delete cascade,
+    email citext not null,
+    invited_by bigint not null references Users(id) on delete cascade,
+    created_at timestamptz not null default now(),
+    unique (event_id, email)
+);
+create index event_invites_email_idx on Event_invites(email);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Event_invites;
+drop table Event_invite_links;
+alter table Event_series
+    drop column visibility;
+alter table Events
+    drop column visibility;
+-- +goose StatementEnd
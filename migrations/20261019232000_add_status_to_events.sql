@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Events existing so far went live when created, so they start out
+-- published (or cancelled); new events start as drafts. When the existing
+-- ones were published is not known.
+alter table Events
+    add column status varchar(16) not null default 'published' check (status in ('draft', 'published', 'completed', 'cancelled')),
+    add column published_at timestamptz;
+update Events set status = 'cancelled' where cancelled_at is not null;
+alter table Events
+    alter column status set default 'draft';
+
+-- Occurrences of a published series are published as they are materialized.
+alter table Event_series
+    add column published_at timestamptz;
+update Event_series set published_at = created_at;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table Event_series
+    drop column published_at;
+alter table Events
+    drop column published_at,
+    drop column status;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Organizers manage an event according to their role: owners manage the
+-- team and can cancel the event, editors everything else, check-in staff
+-- only check tickets. The creator of an event is always one of its owners.
+create table Event_organizers(
+    event_id bigint not null references Events(id) on delete cascade,
+    user_id bigint not null references Users(id) on delete cascade,
+    role varchar(16) not null check (role in ('owner', 'editor', 'checkin')),
+    added_by bigint references Users(id) on delete set null,
+    created_at timestamptz not null default now(),
+    primary key (event_id, user_id)
+);
+create index event_organizers_user_idx on Event_organizers(user_id);
+
+insert into Event_organizers (event_id, user_id, role)
+    select id, created_by, 'owner' from Events;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Event_organizers;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An email invite no longer admits whoever signs up with its address: the
+-- signed code mailed to the address does, and only for the first account
+-- that redeems it.
+alter table Event_invites
+    add column nonce text not null default md5(random()::text || clock_timestamp()::text),
+    add column used_by bigint references Users(id) on delete set null,
+    add column used_at timestamptz;
+create index event_invites_used_by_idx on Event_invites(used_by);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index event_invites_used_by_idx;
+alter table Event_invites
+    drop column used_at,
+    drop column used_by,
+    drop column nonce;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An API key authenticates scripts as its user and gives them a rate limit
+-- bucket of their own. Only the SHA-256 of the key is stored.
+create table Api_keys(
+    id bigint primary key generated by default as identity,
+    user_id bigint not null references Users(id) on delete cascade,
+    name varchar(100) not null,
+    prefix text not null,
+    key_hash text not null unique,
+    created_at timestamptz not null default now(),
+    revoked_at timestamptz
+);
+create index api_keys_user_idx on Api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table Api_keys;
+-- +goose StatementEnd